@@ -17,6 +17,63 @@ async function loadMoreProjects(after) {
     document.querySelector("#projects").insertAdjacentHTML("beforeend", body);
 }
 
+async function loadMorePosts(after) {
+    const button = document.querySelector("#posts-load-more")
+    button.disabled = true;
+    button.classList.add("loading");
+
+    const response = await fetch(`/api/posts?after=${after}`, {
+        method: "GET"
+    });
+
+    if (!response.ok) {
+        console.error("error fetching more posts:", response);
+        return;
+    }
+
+    const body = await response.text();
+    button.remove();
+    document.querySelector("#posts").insertAdjacentHTML("beforeend", body);
+}
+
+async function loadMoreComments(number, after) {
+    const button = document.querySelector("#comments-load-more")
+    button.disabled = true;
+    button.classList.add("loading");
+
+    const response = await fetch(`/api/posts/${number}/comments?after=${after}`, {
+        method: "GET"
+    });
+
+    if (!response.ok) {
+        console.error("error fetching more comments:", response);
+        return;
+    }
+
+    const body = await response.text();
+    button.parentElement.remove();
+    document.querySelector("#comments").insertAdjacentHTML("beforeend", body);
+}
+
+async function loadMoreReplies(button, comment, after) {
+    button.disabled = true;
+    button.classList.add("loading");
+
+    const response = await fetch(`/api/comments/${comment}/replies?after=${after}`, {
+        method: "GET"
+    });
+
+    if (!response.ok) {
+        console.error("error fetching more replies:", response);
+        return;
+    }
+
+    const body = await response.text();
+    const replies = button.closest("ul");
+    button.parentElement.remove();
+    replies.insertAdjacentHTML("beforeend", body);
+}
+
 async function loadLastFM() {
     let response;
     try {
@@ -43,6 +100,9 @@ function lastFMError() {
 }
 
 document.addEventListener('DOMContentLoaded', async () => {
+    if (!document.querySelector("#lastfm")) {
+        return;
+    }
     await loadLastFM();
     setInterval(loadLastFM, 5000);
 }, false);
@@ -0,0 +1,100 @@
+package lastfm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	neturl "net/url"
+	"strconv"
+)
+
+const DefaultBaseURL = "https://ws.audioscrobbler.com/2.0/"
+
+// maxErrorBodySize limits how much of an error response is read.
+const maxErrorBodySize = 64 * 1024
+
+func New(httpClient *http.Client, baseURL string, apiKey string) *Client {
+	if baseURL == "" {
+		baseURL = DefaultBaseURL
+	}
+	return &Client{
+		httpClient: httpClient,
+		baseURL:    baseURL,
+		apiKey:     apiKey,
+	}
+}
+
+type Client struct {
+	httpClient *http.Client
+	baseURL    string
+	apiKey     string
+}
+
+// RecentTracks returns up to limit tracks the user recently listened to, starting with the track currently playing if there is one.
+func (c *Client) RecentTracks(ctx context.Context, user string, limit int) (*RecentTracks, error) {
+	var resp RecentTracksResponse
+	if err := c.do(ctx, "user.getrecenttracks", neturl.Values{
+		"user":     {user},
+		"limit":    {strconv.Itoa(limit)},
+		"extended": {"1"},
+	}, &resp); err != nil {
+		return nil, err
+	}
+	return &resp.RecentTracks, nil
+}
+
+func (c *Client) do(ctx context.Context, method string, params neturl.Values, v any) error {
+	params.Set("method", method)
+	params.Set("api_key", c.apiKey)
+	params.Set("format", "json")
+
+	rq, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"?"+params.Encode(), nil)
+	if err != nil {
+		return fmt.Errorf("lastfm: failed to create request: %w", err)
+	}
+	rs, err := c.httpClient.Do(rq)
+	if err != nil {
+		// the request url contains the api key, so don't leak it through the error
+		var urlErr *neturl.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return fmt.Errorf("lastfm: failed to do request: %w", err)
+	}
+	defer rs.Body.Close()
+
+	if rs.StatusCode != http.StatusOK {
+		return parseError(rs)
+	}
+
+	// Last.fm sometimes reports errors with a 200 status code, so decode into a raw message first
+	var raw json.RawMessage
+	if err = json.NewDecoder(rs.Body).Decode(&raw); err != nil {
+		return fmt.Errorf("lastfm: failed to decode response: %w", err)
+	}
+	var lastFMErr Error
+	if err = json.Unmarshal(raw, &lastFMErr); err == nil && lastFMErr.Code != 0 {
+		lastFMErr.StatusCode = rs.StatusCode
+		return &lastFMErr
+	}
+	if err = json.Unmarshal(raw, v); err != nil {
+		return fmt.Errorf("lastfm: failed to decode response: %w", err)
+	}
+	return nil
+}
+
+func parseError(rs *http.Response) error {
+	body, err := io.ReadAll(io.LimitReader(rs.Body, maxErrorBodySize))
+	if err != nil {
+		return &StatusError{StatusCode: rs.StatusCode}
+	}
+	var lastFMErr Error
+	if err = json.Unmarshal(body, &lastFMErr); err != nil || lastFMErr.Code == 0 {
+		return &StatusError{StatusCode: rs.StatusCode}
+	}
+	lastFMErr.StatusCode = rs.StatusCode
+	return &lastFMErr
+}
@@ -0,0 +1,209 @@
+package lastfm
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientRecentTracks(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     int
+		body       string
+		wantErr    error
+		wantStatus int
+		wantTracks []string
+		wantImage  string
+	}{
+		{
+			name:       "tracks",
+			status:     http.StatusOK,
+			body:       `{"recenttracks":{"track":[{"name":"first","image":[{"size":"small","#text":"s"},{"size":"extralarge","#text":"xl"}],"@attr":{"nowplaying":"true"}},{"name":"second","image":[]}]}}`,
+			wantTracks: []string{"first", "second"},
+			wantImage:  "xl",
+		},
+		{
+			name:       "single track object",
+			status:     http.StatusOK,
+			body:       `{"recenttracks":{"track":{"name":"only","image":[{"size":"large","#text":"l"}]}}}`,
+			wantTracks: []string{"only"},
+			wantImage:  "l",
+		},
+		{
+			name:       "empty image list",
+			status:     http.StatusOK,
+			body:       `{"recenttracks":{"track":[{"name":"first","image":[]}]}}`,
+			wantTracks: []string{"first"},
+		},
+		{
+			name:       "no tracks",
+			status:     http.StatusOK,
+			body:       `{"recenttracks":{"track":[]}}`,
+			wantTracks: []string{},
+		},
+		{
+			name:    "invalid api key",
+			status:  http.StatusForbidden,
+			body:    `{"error":10,"message":"Invalid API key - You must be granted a valid key by last.fm"}`,
+			wantErr: ErrInvalidAPIKey,
+		},
+		{
+			name:    "suspended api key",
+			status:  http.StatusForbidden,
+			body:    `{"error":26,"message":"Suspended API key - Access for your account has been suspended, please contact Last.fm"}`,
+			wantErr: ErrInvalidAPIKey,
+		},
+		{
+			name:    "user not found",
+			status:  http.StatusNotFound,
+			body:    `{"error":6,"message":"User not found"}`,
+			wantErr: ErrUserNotFound,
+		},
+		{
+			name:    "rate limited",
+			status:  http.StatusTooManyRequests,
+			body:    `{"error":29,"message":"Rate Limit Exceeded"}`,
+			wantErr: ErrRateLimited,
+		},
+		{
+			name:    "error body with status 200",
+			status:  http.StatusOK,
+			body:    `{"error":29,"message":"Rate Limit Exceeded"}`,
+			wantErr: ErrRateLimited,
+		},
+		{
+			name:       "non json server error",
+			status:     http.StatusBadGateway,
+			body:       `<html>Bad Gateway</html>`,
+			wantErr:    ErrUnavailable,
+			wantStatus: http.StatusBadGateway,
+		},
+		{
+			name:       "non json rate limit",
+			status:     http.StatusTooManyRequests,
+			body:       `Too Many Requests`,
+			wantErr:    ErrRateLimited,
+			wantStatus: http.StatusTooManyRequests,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				query := r.URL.Query()
+				if query.Get("method") != "user.getrecenttracks" || query.Get("user") != "some user" || query.Get("api_key") != "key" || query.Get("limit") != "2" {
+					t.Errorf("unexpected query: %s", r.URL.RawQuery)
+				}
+				w.WriteHeader(tt.status)
+				_, _ = w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			recentTracks, err := New(server.Client(), server.URL, "key").RecentTracks(context.Background(), "some user", 2)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+				}
+				var statusErr *StatusError
+				if tt.wantStatus != 0 && (!errors.As(err, &statusErr) || statusErr.StatusCode != tt.wantStatus) {
+					t.Fatalf("expected StatusError with status %d, got %v", tt.wantStatus, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			names := make([]string, 0, len(recentTracks.Track))
+			for _, track := range recentTracks.Track {
+				names = append(names, track.Name)
+			}
+			if len(names) != len(tt.wantTracks) {
+				t.Fatalf("expected tracks %v, got %v", tt.wantTracks, names)
+			}
+			for i := range names {
+				if names[i] != tt.wantTracks[i] {
+					t.Fatalf("expected tracks %v, got %v", tt.wantTracks, names)
+				}
+			}
+			if len(names) > 0 {
+				if image := recentTracks.Track[0].Image.URL(ImageSizeExtraLarge); image != tt.wantImage {
+					t.Fatalf("expected image %q, got %q", tt.wantImage, image)
+				}
+			}
+		})
+	}
+}
+
+func TestErrorIs(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{name: "invalid parameters is not user not found", err: &Error{Code: ErrorCodeInvalidParameters, Message: "Invalid parameters"}, want: nil},
+		{name: "service offline", err: &Error{Code: ErrorCodeServiceOffline}, want: ErrUnavailable},
+		{name: "temporary error", err: &Error{Code: ErrorCodeTemporary}, want: ErrUnavailable},
+		{name: "unknown error with server status", err: &Error{StatusCode: http.StatusInternalServerError, Code: 99}, want: ErrUnavailable},
+		{name: "client status", err: &StatusError{StatusCode: http.StatusBadRequest}, want: nil},
+	}
+
+	sentinels := []error{ErrInvalidAPIKey, ErrUserNotFound, ErrRateLimited, ErrUnavailable}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, sentinel := range sentinels {
+				if got := errors.Is(tt.err, sentinel); got != (sentinel == tt.want) {
+					t.Fatalf("errors.Is(%v, %v) = %t", tt.err, sentinel, got)
+				}
+			}
+		})
+	}
+}
+
+func TestImagesURL(t *testing.T) {
+	tests := []struct {
+		name   string
+		images Images
+		size   string
+		want   string
+	}{
+		{name: "no images", images: nil, size: ImageSizeExtraLarge, want: ""},
+		{name: "only empty images", images: Images{{Size: ImageSizeSmall}, {Size: ImageSizeLarge}}, size: ImageSizeLarge, want: ""},
+		{name: "exact size", images: Images{{Size: ImageSizeSmall, Text: "s"}, {Size: ImageSizeMedium, Text: "m"}, {Size: ImageSizeLarge, Text: "l"}}, size: ImageSizeMedium, want: "m"},
+		{name: "falls back to largest", images: Images{{Size: ImageSizeSmall, Text: "s"}, {Size: ImageSizeLarge, Text: "l"}}, size: ImageSizeExtraLarge, want: "l"},
+		{name: "skips empty requested size", images: Images{{Size: ImageSizeSmall, Text: "s"}, {Size: ImageSizeMedium, Text: "m"}, {Size: ImageSizeExtraLarge}}, size: ImageSizeExtraLarge, want: "m"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.images.URL(tt.size); got != tt.want {
+				t.Fatalf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestMessage(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{name: "no error", err: nil, want: ""},
+		{name: "invalid api key", err: &Error{Code: ErrorCodeInvalidAPIKey}, want: "last.fm isn't set up correctly right now"},
+		{name: "user not found", err: &Error{Code: ErrorCodeInvalidParameters, Message: "User not found"}, want: "the last.fm profile could not be found"},
+		{name: "rate limited", err: &StatusError{StatusCode: http.StatusTooManyRequests}, want: "too many requests to last.fm, try again in a bit"},
+		{name: "other errors", err: errors.New("dial tcp: connection refused"), want: "last.fm is unavailable right now"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Message(tt.err); got != tt.want {
+				t.Fatalf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
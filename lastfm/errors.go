@@ -0,0 +1,92 @@
+package lastfm
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Error codes returned by the Last.fm API, see https://www.last.fm/api/errorcodes.
+const (
+	ErrorCodeInvalidService    = 2
+	ErrorCodeInvalidMethod     = 3
+	ErrorCodeAuthFailed        = 4
+	ErrorCodeInvalidFormat     = 5
+	ErrorCodeInvalidParameters = 6
+	ErrorCodeOperationFailed   = 8
+	ErrorCodeInvalidAPIKey     = 10
+	ErrorCodeServiceOffline    = 11
+	ErrorCodeTemporary         = 16
+	ErrorCodeLoginRequired     = 17
+	ErrorCodeSuspendedAPIKey   = 26
+	ErrorCodeRateLimitExceeded = 29
+)
+
+var (
+	ErrInvalidAPIKey = errors.New("invalid api key")
+	ErrUserNotFound  = errors.New("user not found")
+	ErrRateLimited   = errors.New("rate limited")
+	ErrUnavailable   = errors.New("service unavailable")
+)
+
+// Error is an error returned by the Last.fm API.
+// It matches ErrInvalidAPIKey, ErrUserNotFound, ErrRateLimited and ErrUnavailable with errors.Is.
+type Error struct {
+	StatusCode int    `json:"-"`
+	Code       int    `json:"error"`
+	Message    string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("lastfm: error %d: %s", e.Code, e.Message)
+}
+
+func (e *Error) Is(target error) bool {
+	switch target {
+	case ErrInvalidAPIKey:
+		return e.Code == ErrorCodeInvalidAPIKey || e.Code == ErrorCodeSuspendedAPIKey
+	case ErrUserNotFound:
+		// Last.fm doesn't have a dedicated code for unknown users
+		return e.Code == ErrorCodeInvalidParameters && strings.EqualFold(e.Message, "user not found")
+	case ErrRateLimited:
+		return e.Code == ErrorCodeRateLimitExceeded
+	case ErrUnavailable:
+		return e.Code == ErrorCodeOperationFailed || e.Code == ErrorCodeServiceOffline || e.Code == ErrorCodeTemporary || e.StatusCode >= http.StatusInternalServerError
+	}
+	return false
+}
+
+// StatusError is returned when Last.fm responds with an unexpected status code and no error body.
+type StatusError struct {
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("lastfm: unexpected status code %d", e.StatusCode)
+}
+
+func (e *StatusError) Is(target error) bool {
+	switch target {
+	case ErrRateLimited:
+		return e.StatusCode == http.StatusTooManyRequests
+	case ErrUnavailable:
+		return e.StatusCode >= http.StatusInternalServerError
+	}
+	return false
+}
+
+// Message returns a message describing err which can be shown to visitors.
+func Message(err error) string {
+	switch {
+	case err == nil:
+		return ""
+	case errors.Is(err, ErrInvalidAPIKey):
+		return "last.fm isn't set up correctly right now"
+	case errors.Is(err, ErrUserNotFound):
+		return "the last.fm profile could not be found"
+	case errors.Is(err, ErrRateLimited):
+		return "too many requests to last.fm, try again in a bit"
+	}
+	return "last.fm is unavailable right now"
+}
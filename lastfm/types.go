@@ -0,0 +1,101 @@
+package lastfm
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+const (
+	ImageSizeSmall      = "small"
+	ImageSizeMedium     = "medium"
+	ImageSizeLarge      = "large"
+	ImageSizeExtraLarge = "extralarge"
+)
+
+type RecentTracksResponse struct {
+	RecentTracks RecentTracks `json:"recenttracks"`
+}
+
+type RecentTracks struct {
+	Track Tracks `json:"track"`
+	Attr  struct {
+		User       string `json:"user"`
+		TotalPages int    `json:"totalPages,string"`
+		Page       int    `json:"page,string"`
+		Total      int    `json:"total,string"`
+		PerPage    int    `json:"perPage,string"`
+	} `json:"@attr"`
+}
+
+// Tracks is a list of tracks. Last.fm sends a single object instead of an array when there is only one track.
+type Tracks []Track
+
+func (t *Tracks) UnmarshalJSON(data []byte) error {
+	if data = bytes.TrimSpace(data); len(data) > 0 && data[0] == '{' {
+		var track Track
+		if err := json.Unmarshal(data, &track); err != nil {
+			return err
+		}
+		*t = Tracks{track}
+		return nil
+	}
+	return json.Unmarshal(data, (*[]Track)(t))
+}
+
+type Track struct {
+	Artist struct {
+		URL   string `json:"url"`
+		Name  string `json:"name"`
+		Image Images `json:"image"`
+		MbID  string `json:"mbid"`
+	} `json:"artist"`
+	Date *struct {
+		Uts  int64  `json:"uts,string"`
+		Text string `json:"#text"`
+	} `json:"date"`
+	MbID       string `json:"mbid"`
+	Name       string `json:"name"`
+	Image      Images `json:"image"`
+	URL        string `json:"url"`
+	Streamable string `json:"streamable"`
+	Album      struct {
+		MbID string `json:"mbid"`
+		Text string `json:"#text"`
+	} `json:"album"`
+	Loved string `json:"loved"`
+	Attr  struct {
+		NowPlaying string `json:"nowplaying"`
+	} `json:"@attr"`
+}
+
+func (t Track) NowPlaying() bool {
+	return t.Attr.NowPlaying == "true"
+}
+
+func (t Track) IsLoved() bool {
+	return t.Loved == "1"
+}
+
+type Image struct {
+	Size string `json:"size"`
+	Text string `json:"#text"`
+}
+
+type Images []Image
+
+// URL returns the url of the image with the given size.
+// If there is none, the largest available image is used instead. An empty string is returned if there are no images at all.
+func (i Images) URL(size string) string {
+	var largest string
+	for _, image := range i {
+		if image.Text == "" {
+			continue
+		}
+		if image.Size == size {
+			return image.Text
+		}
+		// Last.fm lists images from the smallest to the largest
+		largest = image.Text
+	}
+	return largest
+}
@@ -4,12 +4,14 @@ import (
 	"context"
 	"embed"
 	"flag"
+	"fmt"
 	"html/template"
 	"io"
 	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
@@ -47,22 +49,41 @@ func main() {
 	cfgPath := flag.String("config", "config.yml", "path to config file")
 	flag.Parse()
 
+	if flag.Arg(0) == "check-config" {
+		_ = flag.CommandLine.Parse(flag.Args()[1:])
+		os.Exit(checkConfig(*cfgPath))
+	}
+
 	cfg, err := topi.LoadConfig(*cfgPath)
 	if err != nil {
 		slog.Error("failed to load config", slog.Any("error", err))
 		os.Exit(-1)
 	}
+	if err = cfg.Validate(); err != nil {
+		slog.Error("invalid config", slog.Any("error", err))
+		os.Exit(-1)
+	}
 	setupLogger(cfg.Log)
 
 	slog.Info("Starting topi.wtf...", slog.Any("config", cfg), slog.Any("version", version), slog.Any("commit", commit), slog.Any("buildTime", buildTime))
 
 	var (
-		tmplFunc topi.ExecuteTemplateFunc
-		assets   http.FileSystem
+		tmplFunc      topi.ExecuteTemplateFunc
+		assets        http.FileSystem
+		assetManifest *topi.AssetManifest
 	)
 
+	if !cfg.DevMode {
+		// assets are edited in place in dev mode, so they are only fingerprinted in production
+		if assetManifest, err = topi.NewAssetManifest(Assets); err != nil {
+			slog.Error("failed to fingerprint assets", slog.Any("error", err))
+			os.Exit(-1)
+		}
+	}
+
 	funcs := template.FuncMap{
 		"humanizeTime": humanize.Time,
+		"asset":        assetManifest.Path,
 	}
 
 	if cfg.DevMode {
@@ -85,12 +106,26 @@ func main() {
 		assets = http.FS(Assets)
 	}
 
+	if cfg.Otel != nil {
+		tp, err := topi.NewTracerProvider(context.Background(), *cfg.Otel, version)
+		if err != nil {
+			slog.Error("failed to setup tracing", slog.Any("error", err))
+			os.Exit(-1)
+		}
+		defer func() {
+			if err = tp.Shutdown(context.Background()); err != nil {
+				slog.Error("failed to shutdown tracing", slog.Any("error", err))
+			}
+		}()
+	}
+
+	// every attempt of a retried request gets its own span
+	transport := topi.NewRetryTransport(topi.NewTracingTransport(http.DefaultTransport), cfg.Retry)
 	httpClient := &http.Client{
-		Timeout: 10 * time.Second,
+		Transport: transport,
+		Timeout:   10 * time.Second,
 	}
-	githubClient := githubv4.NewClient(oauth2.NewClient(context.Background(), oauth2.StaticTokenSource(
-		&oauth2.Token{AccessToken: cfg.GitHub.AccessToken},
-	)))
+	githubClient := newGitHubClient(cfg.GitHub.AccessToken, transport)
 
 	md := goldmark.New(
 		goldmark.WithRendererOptions(
@@ -111,14 +146,77 @@ func main() {
 		),
 	)
 
-	s := topi.NewServer(topi.FormatBuildVersion(version, commit, buildTime), cfg, httpClient, githubClient, md, assets, tmplFunc)
+	var disk *topi.DiskStore
+	if cfg.DataDir != "" {
+		if disk, err = topi.OpenDiskStore(cfg.DataDir); err != nil {
+			slog.Error("failed to open data dir", slog.Any("error", err))
+			os.Exit(-1)
+		}
+		defer disk.Close()
+	}
+
+	s := topi.NewServer(topi.FormatBuildVersion(version, commit, buildTime), cfg, httpClient, githubClient, md, assets, assetManifest, tmplFunc, disk)
 	go s.Start()
-	defer s.Close()
+	defer func() {
+		s.Close()
+	}()
 
 	slog.Info("started topi.wtf", slog.Any("listen_addr", cfg.ListenAddr))
 	si := make(chan os.Signal, 1)
-	signal.Notify(si, syscall.SIGINT, syscall.SIGTERM, os.Interrupt)
-	<-si
+	signal.Notify(si, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP, os.Interrupt)
+	for sig := range si {
+		if sig != syscall.SIGHUP {
+			break
+		}
+		s = reloadConfig(*cfgPath, s, transport)
+	}
+	slog.Info("shutting down topi.wtf...")
+}
+
+func newGitHubClient(accessToken string, transport http.RoundTripper) *githubv4.Client {
+	// GraphQL queries are sent as POST requests, but they are read-only and safe to retry
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, &http.Client{
+		Transport: topi.RecordResponses(topi.MarkIdempotent(transport)),
+	})
+	return githubv4.NewClient(oauth2.NewClient(ctx, oauth2.StaticTokenSource(
+		&oauth2.Token{AccessToken: accessToken},
+	)))
+}
+
+func reloadConfig(path string, s *topi.Server, transport http.RoundTripper) *topi.Server {
+	slog.Info("reloading config", slog.String("path", path))
+	cfg, err := topi.LoadConfig(path)
+	if err != nil {
+		slog.Error("failed to reload config, keeping the current one", slog.Any("error", err))
+		return s
+	}
+	if err = cfg.Validate(); err != nil {
+		slog.Error("invalid config, keeping the current one", slog.Any("error", err))
+		return s
+	}
+	setupLogger(cfg.Log)
+
+	slog.Info("reloaded config", slog.Any("config", cfg))
+	return s.Reload(cfg, newGitHubClient(cfg.GitHub.AccessToken, transport))
+}
+
+func checkConfig(path string) int {
+	cfg, err := topi.LoadConfig(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to load config %s: %s\n", path, err)
+		return 1
+	}
+
+	if err = cfg.Validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "config %s is invalid:\n", path)
+		for _, line := range strings.Split(err.Error(), "\n") {
+			fmt.Fprintf(os.Stderr, "  - %s\n", line)
+		}
+		return 1
+	}
+
+	fmt.Printf("config %s is valid:%s", path, cfg)
+	return 0
 }
 
 const (
@@ -0,0 +1,177 @@
+package topi
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/andybalholm/brotli"
+)
+
+// assetHashLength is the number of hex characters of the content hash put into asset paths.
+const assetHashLength = 10
+
+// assetEncodings are the encodings assets are precompressed with, in order of preference.
+var assetEncodings = []string{"br", "gzip"}
+
+// NewAssetManifest fingerprints and precompresses every file below the assets directory of fsys.
+func NewAssetManifest(fsys fs.FS) (*AssetManifest, error) {
+	m := &AssetManifest{
+		paths:      map[string]string{},
+		files:      map[string]string{},
+		compressed: map[string][]compressedAsset{},
+	}
+	err := fs.WalkDir(fsys, "assets", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return err
+		}
+		sum := sha256.Sum256(data)
+		hash := hex.EncodeToString(sum[:])[:assetHashLength]
+
+		ext := path.Ext(name)
+		hashed := strings.TrimSuffix(name, ext) + "." + hash + ext
+		m.paths[strings.TrimPrefix(name, "assets/")] = "/" + hashed
+		m.files["/"+hashed] = "/" + name
+
+		compressed, err := compressAsset(data)
+		if err != nil {
+			return fmt.Errorf("failed to compress %s: %w", name, err)
+		}
+		if len(compressed) > 0 {
+			m.compressed["/"+name] = compressed
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// AssetManifest maps assets to paths containing a hash of their content,
+// so they can be cached forever and deploys still invalidate them.
+// A nil AssetManifest returns the plain paths, which is used in dev mode.
+type AssetManifest struct {
+	// paths maps asset names like style.css to their hashed path
+	paths map[string]string
+	// files maps hashed paths to the path of the file
+	files map[string]string
+	// compressed maps the path of a file to its precompressed variants
+	compressed map[string][]compressedAsset
+}
+
+type compressedAsset struct {
+	encoding string
+	data     []byte
+}
+
+// Path returns the hashed path of the asset name, e.g. style.css becomes /assets/style.1a2b3c4d5e.css.
+func (m *AssetManifest) Path(name string) string {
+	if m != nil {
+		if hashed, ok := m.paths[name]; ok {
+			return hashed
+		}
+	}
+	return "/assets/" + name
+}
+
+// Handler serves hashed paths with an immutable Cache-Control header and everything else as is.
+// If the client accepts it, a precompressed variant of the file is served.
+func (m *AssetManifest) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if m == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		file := r.URL.Path
+		if unhashed, ok := m.files[file]; ok {
+			w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+			file = unhashed
+		}
+
+		if variants, ok := m.compressed[file]; ok {
+			w.Header().Add("Vary", "Accept-Encoding")
+			acceptEncoding := r.Header.Get("Accept-Encoding")
+			for _, variant := range variants {
+				if acceptsEncoding(acceptEncoding, variant.encoding) {
+					w.Header().Set("Content-Encoding", variant.encoding)
+					http.ServeContent(w, r, file, time.Time{}, bytes.NewReader(variant.data))
+					return
+				}
+			}
+		}
+
+		if file != r.URL.Path {
+			r2 := new(http.Request)
+			*r2 = *r
+			r2.URL = new(url.URL)
+			*r2.URL = *r.URL
+			r2.URL.Path = file
+			r = r2
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// compressAsset compresses data with all assetEncodings. Variants which are not smaller than data are dropped.
+func compressAsset(data []byte) ([]compressedAsset, error) {
+	var variants []compressedAsset
+	for _, encoding := range assetEncodings {
+		buf := new(bytes.Buffer)
+		var w io.WriteCloser
+		switch encoding {
+		case "br":
+			w = brotli.NewWriterLevel(buf, brotli.BestCompression)
+		case "gzip":
+			w, _ = gzip.NewWriterLevel(buf, gzip.BestCompression)
+		}
+		if _, err := w.Write(data); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+
+		if buf.Len() < len(data) {
+			variants = append(variants, compressedAsset{
+				encoding: encoding,
+				data:     buf.Bytes(),
+			})
+		}
+	}
+	return variants, nil
+}
+
+// acceptsEncoding reports whether the Accept-Encoding header value acceptEncoding allows encoding.
+func acceptsEncoding(acceptEncoding string, encoding string) bool {
+	for _, accepted := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(accepted, ";")
+		name = strings.TrimSpace(name)
+		if name != encoding && name != "*" {
+			continue
+		}
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if value, err := strconv.ParseFloat(q, 64); err == nil && value == 0 {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
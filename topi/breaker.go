@@ -0,0 +1,139 @@
+package topi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+const (
+	BreakerStateClosed   = "closed"
+	BreakerStateOpen     = "open"
+	BreakerStateHalfOpen = "half_open"
+)
+
+var ErrCircuitOpen = errors.New("upstream is temporarily unavailable")
+
+func NewCircuitBreaker(upstream string, cfg CircuitBreakerConfig, metrics *Metrics) *CircuitBreaker {
+	metrics.ObserveBreaker(upstream, BreakerStateClosed)
+	return &CircuitBreaker{
+		upstream: upstream,
+		cfg:      cfg,
+		metrics:  metrics,
+		state:    BreakerStateClosed,
+	}
+}
+
+// CircuitBreaker stops calling an upstream after too many consecutive failures, so requests fail fast
+// instead of waiting for timeouts. After the cooldown a single trial call decides whether it closes again.
+type CircuitBreaker struct {
+	upstream string
+	cfg      CircuitBreakerConfig
+	metrics  *Metrics
+
+	mu       sync.Mutex
+	state    string
+	failures int
+	openedAt time.Time
+	trial    bool
+}
+
+type BreakerStatus struct {
+	State    string     `json:"state"`
+	Failures int        `json:"failures"`
+	OpenedAt *time.Time `json:"opened_at,omitempty"`
+}
+
+// Do calls fn unless the breaker is open, in which case an error wrapping ErrCircuitOpen is returned.
+// Errors caused by ctx being canceled don't count as failures.
+func (b *CircuitBreaker) Do(ctx context.Context, fn func(ctx context.Context) error) error {
+	if err := b.allow(); err != nil {
+		return err
+	}
+
+	err := fn(ctx)
+	if err != nil && ctx.Err() != nil {
+		b.mu.Lock()
+		b.trial = false
+		b.mu.Unlock()
+		return err
+	}
+	b.Report(err)
+	return err
+}
+
+func (b *CircuitBreaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case BreakerStateOpen:
+		if time.Since(b.openedAt) < b.cfg.Cooldown {
+			return fmt.Errorf("%s: %w", b.upstream, ErrCircuitOpen)
+		}
+		b.setState(BreakerStateHalfOpen)
+		fallthrough
+	case BreakerStateHalfOpen:
+		// only let a single trial call through
+		if b.trial {
+			return fmt.Errorf("%s: %w", b.upstream, ErrCircuitOpen)
+		}
+		b.trial = true
+	}
+	return nil
+}
+
+// Report records the outcome of a call to the upstream.
+func (b *CircuitBreaker) Report(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.trial = false
+
+	if err == nil {
+		b.failures = 0
+		if b.state != BreakerStateClosed {
+			b.setState(BreakerStateClosed)
+		}
+		return
+	}
+
+	b.failures++
+	if b.state == BreakerStateHalfOpen || (b.state == BreakerStateClosed && b.failures >= b.cfg.Failures) {
+		b.openedAt = time.Now()
+		b.setState(BreakerStateOpen)
+	}
+}
+
+func (b *CircuitBreaker) setState(state string) {
+	b.state = state
+	b.metrics.ObserveBreaker(b.upstream, state)
+	if state == BreakerStateOpen {
+		slog.Warn("circuit breaker opened, failing fast", slog.String("upstream", b.upstream), slog.Int("failures", b.failures), slog.Duration("cooldown", b.cfg.Cooldown))
+		return
+	}
+	slog.Info("circuit breaker changed state", slog.String("upstream", b.upstream), slog.String("state", state))
+}
+
+// Open reports whether calls to the upstream currently fail fast.
+func (b *CircuitBreaker) Open() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state != BreakerStateClosed
+}
+
+func (b *CircuitBreaker) Status() BreakerStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	status := BreakerStatus{
+		State:    b.state,
+		Failures: b.failures,
+	}
+	if b.state != BreakerStateClosed {
+		openedAt := b.openedAt
+		status.OpenedAt = &openedAt
+	}
+	return status
+}
@@ -0,0 +1,161 @@
+package topi
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-chi/stampede"
+)
+
+const (
+	CacheGitHub  = "github"
+	CacheLastFM  = "lastfm"
+	CacheSitemap = "sitemap"
+)
+
+// NewDataCache creates a DataCache holding up to size values for ttl. If size or ttl is zero nothing is cached.
+// If stretch is not nil, it decides for how long values are actually used.
+func NewDataCache(name string, size int, ttl time.Duration, metrics *Metrics, stretch StretchFunc) *DataCache {
+	c := &DataCache{
+		name:    name,
+		ttl:     ttl,
+		stretch: stretch,
+		metrics: metrics,
+	}
+	if size > 0 && ttl > 0 {
+		retention := ttl
+		if stretch != nil {
+			// keep values around, so they can still be served while the rate limit is low
+			retention = max(ttl*rateLimitStretchFactor, rateLimitRetention)
+		}
+		c.cache = stampede.NewCache(size, retention, retention)
+	}
+	return c
+}
+
+// DataCache caches upstream data with its markdown already rendered, so one value serves every theme.
+// Concurrent misses for the same key only result in a single upstream call.
+type DataCache struct {
+	name    string
+	cache   *stampede.Cache
+	ttl     time.Duration
+	stretch StretchFunc
+	metrics *Metrics
+}
+
+type cacheEntry struct {
+	value     any
+	fetchedAt time.Time
+}
+
+// expired reports whether entry has to be fetched again.
+func (c *DataCache) expired(entry cacheEntry) bool {
+	ttl, ok := c.ttl, true
+	if c.stretch != nil {
+		ttl, ok = c.stretch(c.ttl)
+	}
+	return ok && time.Since(entry.fetchedAt) > ttl
+}
+
+// cached returns the value cached under key or calls fn to fetch it.
+// Errors are not cached. The returned value is shared and must be treated as read-only.
+func cached[T any](ctx context.Context, c *DataCache, key string, fn func(ctx context.Context) (T, error)) (T, error) {
+	if c.cache == nil {
+		return fn(ctx)
+	}
+
+	var miss atomic.Bool
+	fetch := func(ctx context.Context) (any, error) {
+		miss.Store(true)
+		value, err := fn(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return cacheEntry{
+			value:     value,
+			fetchedAt: time.Now(),
+		}, nil
+	}
+
+	v, err := c.cache.GetFresh(ctx, key, fetch)
+	if err == nil && !miss.Load() && c.expired(v.(cacheEntry)) {
+		v, _, err = c.cache.Set(ctx, key, fetch)
+	}
+	c.metrics.ObserveCache(c.name, !miss.Load())
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return v.(cacheEntry).value.(T), nil
+}
+
+func (s *Server) cachedRepositories(ctx context.Context, after string) (*Variables, error) {
+	return cached(ctx, s.cache, "repositories:"+after, func(ctx context.Context) (*Variables, error) {
+		return s.FetchRepositories(ctx, after)
+	})
+}
+
+func (s *Server) cachedPosts(ctx context.Context, after string) (*Variables, error) {
+	return cached(ctx, s.cache, "posts:"+after, func(ctx context.Context) (*Variables, error) {
+		vars, err := s.FetchPosts(ctx, after)
+		if err != nil {
+			return nil, err
+		}
+		if err = s.HighlightData(ctx, vars); err != nil {
+			return nil, fmt.Errorf("failed to highlight posts: %w", err)
+		}
+		return vars, nil
+	})
+}
+
+func (s *Server) cachedSitemapPosts(ctx context.Context) ([]SitemapPost, error) {
+	return cached(ctx, s.sitemapCache, "sitemap", s.FetchSitemapPosts)
+}
+
+func (s *Server) cachedPost(ctx context.Context, number int) (*Variables, error) {
+	return cached(ctx, s.cache, fmt.Sprintf("post:%d", number), func(ctx context.Context) (*Variables, error) {
+		vars, err := s.FetchPost(ctx, number)
+		if err != nil {
+			return nil, err
+		}
+		if err = s.HighlightData(ctx, vars); err != nil {
+			return nil, fmt.Errorf("failed to highlight post: %w", err)
+		}
+		return vars, nil
+	})
+}
+
+func (s *Server) cachedComments(ctx context.Context, number int, after string) (*Post, error) {
+	return cached(ctx, s.cache, fmt.Sprintf("comments:%d:%s", number, after), func(ctx context.Context) (*Post, error) {
+		post, err := s.FetchComments(ctx, number, after)
+		if err != nil {
+			return nil, err
+		}
+		if err = s.HighlightPost(post); err != nil {
+			return nil, fmt.Errorf("failed to highlight comments: %w", err)
+		}
+		return post, nil
+	})
+}
+
+func (s *Server) cachedReplies(ctx context.Context, commentID string, after string) (*Comment, error) {
+	return cached(ctx, s.cache, "replies:"+commentID+":"+after, func(ctx context.Context) (*Comment, error) {
+		comment, err := s.FetchReplies(ctx, commentID, after)
+		if err != nil {
+			return nil, err
+		}
+		if err = s.HighlightComment(comment); err != nil {
+			return nil, fmt.Errorf("failed to highlight replies: %w", err)
+		}
+		return comment, nil
+	})
+}
+
+func (s *Server) cachedLastFM(ctx context.Context) LastFM {
+	lastFM, _ := cached(ctx, s.lastFMCache, "lastfm", func(ctx context.Context) (LastFM, error) {
+		return s.FetchLastFM(ctx), nil
+	})
+	return lastFM
+}
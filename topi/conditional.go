@@ -0,0 +1,133 @@
+package topi
+
+import (
+	"bytes"
+	"encoding/hex"
+	"hash/fnv"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// conditional buffers successful GET and HEAD responses to compute their ETag
+// and answers If-None-Match and If-Modified-Since requests with 304 Not Modified.
+func conditional(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		rw := &bufferedResponseWriter{ResponseWriter: w}
+		next.ServeHTTP(rw, r)
+
+		if rw.status != http.StatusOK {
+			rw.flush()
+			return
+		}
+
+		if w.Header().Get("ETag") == "" {
+			w.Header().Set("ETag", etag(rw.buf.Bytes()))
+		}
+		if notModified(r, w.Header()) {
+			w.Header().Del("Content-Type")
+			w.Header().Del("Content-Length")
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		rw.flush()
+	})
+}
+
+type bufferedResponseWriter struct {
+	http.ResponseWriter
+	status int
+	buf    bytes.Buffer
+}
+
+func (w *bufferedResponseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+func (w *bufferedResponseWriter) Write(p []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	return w.buf.Write(p)
+}
+
+func (w *bufferedResponseWriter) flush() {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+	_, _ = w.ResponseWriter.Write(w.buf.Bytes())
+}
+
+// etag returns a weak ETag of body. It is weak since the body might be compressed afterward.
+func etag(body []byte) string {
+	h := fnv.New64a()
+	_, _ = h.Write(body)
+	return `W/"` + hex.EncodeToString(h.Sum(nil)) + `"`
+}
+
+// notModified reports whether the client already has the current response.
+// If-Modified-Since is ignored when If-None-Match is present.
+func notModified(r *http.Request, header http.Header) bool {
+	if ifNoneMatch := r.Header.Get("If-None-Match"); ifNoneMatch != "" {
+		current := strings.TrimPrefix(header.Get("ETag"), "W/")
+		for _, tag := range strings.Split(ifNoneMatch, ",") {
+			tag = strings.TrimSpace(tag)
+			if tag == "*" || strings.TrimPrefix(tag, "W/") == current {
+				return true
+			}
+		}
+		return false
+	}
+
+	ifModifiedSince, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+	lastModified, err := http.ParseTime(header.Get("Last-Modified"))
+	if err != nil {
+		return false
+	}
+	return !lastModified.After(ifModifiedSince)
+}
+
+// setLastModified sets the Last-Modified header to t unless it is zero.
+func setLastModified(w http.ResponseWriter, t time.Time) {
+	if t.IsZero() {
+		return
+	}
+	w.Header().Set("Last-Modified", t.UTC().Format(http.TimeFormat))
+}
+
+// lastModified returns the newest change of the projects, posts, comments and replies in vars,
+// but not before the data was fetched since upvotes and edits don't show up in any timestamp.
+func lastModified(vars *Variables) time.Time {
+	t := vars.FetchedAt
+	latest := func(ts time.Time) {
+		if ts.After(t) {
+			t = ts
+		}
+	}
+	for _, project := range vars.Projects {
+		latest(project.UpdatedAt)
+	}
+	posts := vars.Posts
+	if vars.Post != nil {
+		posts = append(posts[:len(posts):len(posts)], *vars.Post)
+	}
+	for _, post := range posts {
+		latest(post.CreatedAt)
+		for _, comment := range post.Comments {
+			latest(comment.CreatedAt)
+			for _, reply := range comment.Replies {
+				latest(reply.CreatedAt)
+			}
+		}
+	}
+	return t
+}
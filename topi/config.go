@@ -1,55 +1,303 @@
 package topi
 
 import (
+	"encoding"
+	"errors"
 	"fmt"
 	"log/slog"
+	"net"
+	"net/url"
 	"os"
+	"reflect"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
 
 	"gopkg.in/yaml.v3"
 )
 
+// EnvPrefix is the prefix of all environment variables overriding config values.
+// The variable name is built from the yaml keys, e.g. github.access_token becomes TOPI_GITHUB_ACCESS_TOKEN.
+// Appending _FILE to the name reads the value from the file at the given path instead.
+const EnvPrefix = "TOPI"
+
 func LoadConfig(path string) (Config, error) {
 	file, err := os.Open(path)
 	if err != nil {
 		return Config{}, err
 	}
+	defer file.Close()
+
+	decoder := yaml.NewDecoder(file)
+	decoder.KnownFields(true)
+
+	cfg := Config{
+		Server:         DefaultServerConfig,
+		GitHub:         DefaultGitHubConfig,
+		LastFM:         DefaultLastFMConfig,
+		Retry:          DefaultRetryConfig,
+		CircuitBreaker: DefaultCircuitBreakerConfig,
+		CacheControl:   DefaultCacheControlConfig(),
+	}
+	if err = decoder.Decode(&cfg); err != nil {
+		return Config{}, fmt.Errorf("failed to decode config: %w", err)
+	}
 
-	var cfg Config
-	if err = yaml.NewDecoder(file).Decode(&cfg); err != nil {
+	if _, err = loadEnv(reflect.ValueOf(&cfg).Elem(), EnvPrefix); err != nil {
 		return Config{}, err
 	}
 	return cfg, nil
 }
 
+// loadEnv overrides the fields of the struct v with the values of matching environment variables.
+// It reports whether any field was set.
+func loadEnv(v reflect.Value, prefix string) (bool, error) {
+	var set bool
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("yaml"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		key := prefix + "_" + strings.ToUpper(name)
+		field := v.Field(i)
+
+		if field.Kind() == reflect.Struct && !isTextUnmarshaler(field) {
+			fieldSet, err := loadEnv(field, key)
+			if err != nil {
+				return false, err
+			}
+			set = set || fieldSet
+			continue
+		}
+
+		if field.Kind() == reflect.Pointer && field.Type().Elem().Kind() == reflect.Struct {
+			value := reflect.New(field.Type().Elem())
+			if !field.IsNil() {
+				value.Elem().Set(field.Elem())
+			}
+			fieldSet, err := loadEnv(value.Elem(), key)
+			if err != nil {
+				return false, err
+			}
+			if fieldSet {
+				field.Set(value)
+				set = true
+			}
+			continue
+		}
+
+		value, ok, err := lookupEnv(key)
+		if err != nil {
+			return false, err
+		}
+		if !ok {
+			continue
+		}
+		if err = setValue(field, value); err != nil {
+			return false, fmt.Errorf("failed to parse %s: %w", key, err)
+		}
+		set = true
+	}
+	return set, nil
+}
+
+// lookupEnv returns the value of the environment variable key.
+// If key_FILE is set, the value is read from the file it points to instead.
+func lookupEnv(key string) (string, bool, error) {
+	if path := os.Getenv(key + "_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", false, fmt.Errorf("failed to read %s_FILE: %w", key, err)
+		}
+		return strings.TrimRight(string(data), "\r\n"), true, nil
+	}
+
+	value, ok := os.LookupEnv(key)
+	return value, ok, nil
+}
+
+func isTextUnmarshaler(v reflect.Value) bool {
+	_, ok := v.Addr().Interface().(encoding.TextUnmarshaler)
+	return ok
+}
+
+func setValue(v reflect.Value, value string) error {
+	if unmarshaler, ok := v.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return unmarshaler.UnmarshalText([]byte(value))
+	}
+
+	if v.Type() == reflect.TypeOf(time.Duration(0)) {
+		duration, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(duration))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(value, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(i)
+	default:
+		return fmt.Errorf("unsupported config type: %s", v.Type())
+	}
+	return nil
+}
+
 type Config struct {
-	Log        LogConfig    `yaml:"log"`
-	Debug      bool         `yaml:"debug"`
-	DevMode    bool         `yaml:"dev_mode"`
-	ListenAddr string       `yaml:"listen_addr"`
-	GitHub     GitHubConfig `yaml:"github"`
-	Cache      *CacheConfig `yaml:"cache"`
-	LastFM     LastFMConfig `yaml:"lastfm"`
+	Log             LogConfig            `yaml:"log"`
+	Debug           bool                 `yaml:"debug"`
+	DevMode         bool                 `yaml:"dev_mode"`
+	ListenAddr      string               `yaml:"listen_addr"`
+	AdminListenAddr string               `yaml:"admin_listen_addr"`
+	PublicURL       string               `yaml:"public_url"`
+	DataDir         string               `yaml:"data_dir"`
+	Server          ServerConfig         `yaml:"server"`
+	TLS             *TLSConfig           `yaml:"tls"`
+	GitHub          GitHubConfig         `yaml:"github"`
+	Cache           *CacheConfig         `yaml:"cache"`
+	LastFM          LastFMConfig         `yaml:"lastfm"`
+	Otel            *OtelConfig          `yaml:"otel"`
+	CacheControl    CacheControlConfig   `yaml:"cache_control"`
+	Retry           RetryConfig          `yaml:"retry"`
+	CircuitBreaker  CircuitBreakerConfig `yaml:"circuit_breaker"`
 }
 
 func (c Config) String() string {
-	return fmt.Sprintf("\n Log: %s\n DevMode: %t\n Debug: %t\n ListenAddr: %s\n GitHub: %s\n Cache: %s\n LastFM: %s\n",
+	return fmt.Sprintf("\n Precedence: %s_*_FILE > %s_* > config file\n Log: %s\n DevMode: %t\n Debug: %t\n ListenAddr: %s\n AdminListenAddr: %s\n PublicURL: %s\n DataDir: %s\n Server: %s\n TLS: %s\n GitHub: %s\n Cache: %s\n LastFM: %s\n Otel: %s\n CacheControl: %s\n Retry: %s\n CircuitBreaker: %s\n",
+		EnvPrefix,
+		EnvPrefix,
 		c.Log,
 		c.DevMode,
 		c.Debug,
 		c.ListenAddr,
+		c.AdminListenAddr,
+		c.PublicURL,
+		c.DataDir,
+		c.Server,
+		c.TLS,
 		c.GitHub,
 		c.Cache,
 		c.LastFM,
+		c.Otel,
+		c.CacheControl,
+		c.Retry,
+		c.CircuitBreaker,
 	)
 }
 
+// Validate checks the config for missing or invalid values and reports all problems at once.
+func (c Config) Validate() error {
+	var errs []error
+	if err := c.Log.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if _, _, err := net.SplitHostPort(c.ListenAddr); err != nil {
+		errs = append(errs, fmt.Errorf("listen_addr %q is invalid, expected host:port like 127.0.0.1:80 or :80: %w", c.ListenAddr, err))
+	}
+	if c.AdminListenAddr != "" {
+		if _, _, err := net.SplitHostPort(c.AdminListenAddr); err != nil {
+			errs = append(errs, fmt.Errorf("admin_listen_addr %q is invalid, expected host:port like 127.0.0.1:9100: %w", c.AdminListenAddr, err))
+		}
+	}
+	if err := validatePublicURL(c.PublicURL); err != nil {
+		errs = append(errs, err)
+	}
+	if err := c.Server.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if c.TLS != nil {
+		if err := c.TLS.Validate(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := c.GitHub.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if c.Cache != nil {
+		if err := validateCache("cache", c.Cache.Size, c.Cache.TTL); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := c.LastFM.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if c.Otel != nil {
+		if err := required("otel.endpoint", c.Otel.Endpoint); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := c.CacheControl.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := c.Retry.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := c.CircuitBreaker.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// validatePublicURL checks that the public url is an absolute http(s) url without query or fragment.
+func validatePublicURL(publicURL string) error {
+	if err := required("public_url", publicURL); err != nil {
+		return err
+	}
+	u, err := url.Parse(publicURL)
+	if err != nil {
+		return fmt.Errorf("public_url %q is invalid: %w", publicURL, err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.RawQuery != "" || u.Fragment != "" || u.User != nil {
+		return fmt.Errorf("public_url %q is invalid, expected an absolute url like https://topi.wtf", publicURL)
+	}
+	return nil
+}
+
+func validateCache(name string, size int, ttl time.Duration) error {
+	var errs []error
+	if size < 0 {
+		errs = append(errs, fmt.Errorf("%s.size must not be negative, got %d", name, size))
+	}
+	if ttl < 0 {
+		errs = append(errs, fmt.Errorf("%s.ttl must not be negative, got %s", name, ttl))
+	}
+	if (size == 0) != (ttl == 0) {
+		errs = append(errs, fmt.Errorf("%s.size and %s.ttl must either both be set to enable caching or both be 0 to disable it", name, name))
+	}
+	if ttl > 0 && ttl < time.Second {
+		errs = append(errs, fmt.Errorf("%s.ttl must be at least 1s, got %s", name, ttl))
+	}
+	return errors.Join(errs...)
+}
+
+func required(name string, value string) error {
+	if value != "" {
+		return nil
+	}
+	key := EnvPrefix + "_" + strings.ToUpper(strings.ReplaceAll(name, ".", "_"))
+	return fmt.Errorf("%s is required, set it in the config file or via %s or %s_FILE", name, key, key)
+}
+
 type LogConfig struct {
-	Level     slog.Level `cfg:"level"`
-	Format    string     `cfg:"format"`
-	AddSource bool       `cfg:"add_source"`
-	NoColor   bool       `cfg:"no_color"`
+	Level     slog.Level `yaml:"level"`
+	Format    string     `yaml:"format"`
+	AddSource bool       `yaml:"add_source"`
+	NoColor   bool       `yaml:"no_color"`
 }
 
 func (c LogConfig) String() string {
@@ -61,18 +309,155 @@ func (c LogConfig) String() string {
 	)
 }
 
+func (c LogConfig) Validate() error {
+	if c.Format != "json" && c.Format != "text" {
+		return fmt.Errorf("log.format must be one of json or text, got %q", c.Format)
+	}
+	return nil
+}
+
+var DefaultServerConfig = ServerConfig{
+	ShutdownTimeout:   10 * time.Second,
+	ReadTimeout:       10 * time.Second,
+	ReadHeaderTimeout: 5 * time.Second,
+	WriteTimeout:      30 * time.Second,
+	IdleTimeout:       2 * time.Minute,
+}
+
+type ServerConfig struct {
+	ShutdownTimeout   time.Duration `yaml:"shutdown_timeout"`
+	ReadTimeout       time.Duration `yaml:"read_timeout"`
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout"`
+	WriteTimeout      time.Duration `yaml:"write_timeout"`
+	IdleTimeout       time.Duration `yaml:"idle_timeout"`
+}
+
+func (c ServerConfig) String() string {
+	return fmt.Sprintf("\n  ShutdownTimeout: %s\n  ReadTimeout: %s\n  ReadHeaderTimeout: %s\n  WriteTimeout: %s\n  IdleTimeout: %s",
+		c.ShutdownTimeout,
+		c.ReadTimeout,
+		c.ReadHeaderTimeout,
+		c.WriteTimeout,
+		c.IdleTimeout,
+	)
+}
+
+func (c ServerConfig) Validate() error {
+	var errs []error
+	for _, timeout := range []struct {
+		name  string
+		value time.Duration
+	}{
+		{"shutdown_timeout", c.ShutdownTimeout},
+		{"read_timeout", c.ReadTimeout},
+		{"read_header_timeout", c.ReadHeaderTimeout},
+		{"write_timeout", c.WriteTimeout},
+		{"idle_timeout", c.IdleTimeout},
+	} {
+		if timeout.value < 0 {
+			errs = append(errs, fmt.Errorf("server.%s must not be negative, got %s", timeout.name, timeout.value))
+		}
+	}
+	if c.ReadTimeout > 0 && c.ReadHeaderTimeout > c.ReadTimeout {
+		errs = append(errs, fmt.Errorf("server.read_header_timeout (%s) must not exceed server.read_timeout (%s)", c.ReadHeaderTimeout, c.ReadTimeout))
+	}
+	return errors.Join(errs...)
+}
+
+type TLSConfig struct {
+	Cert         string `yaml:"cert"`
+	Key          string `yaml:"key"`
+	RedirectAddr string `yaml:"redirect_addr"`
+}
+
+func (c TLSConfig) String() string {
+	return fmt.Sprintf("\n  Cert: %s\n  Key: %s\n  RedirectAddr: %s",
+		c.Cert,
+		c.Key,
+		c.RedirectAddr,
+	)
+}
+
+func (c TLSConfig) Validate() error {
+	errs := []error{
+		required("tls.cert", c.Cert),
+		required("tls.key", c.Key),
+	}
+	for _, file := range []struct {
+		name string
+		path string
+	}{
+		{"tls.cert", c.Cert},
+		{"tls.key", c.Key},
+	} {
+		if file.path == "" {
+			continue
+		}
+		if _, err := os.Stat(file.path); err != nil {
+			errs = append(errs, fmt.Errorf("%s is not readable: %w", file.name, err))
+		}
+	}
+	if c.RedirectAddr != "" {
+		if _, _, err := net.SplitHostPort(c.RedirectAddr); err != nil {
+			errs = append(errs, fmt.Errorf("tls.redirect_addr %q is invalid, expected host:port like :80: %w", c.RedirectAddr, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+var DefaultGitHubConfig = GitHubConfig{
+	RateLimitLow:      1000,
+	RateLimitCritical: 100,
+}
+
 type GitHubConfig struct {
-	AccessToken string `yaml:"access_token"`
-	User        string `yaml:"user"`
+	AccessToken       string        `yaml:"access_token"`
+	User              string        `yaml:"user"`
+	PostsRepository   string        `yaml:"posts_repository"`
+	PostsCategory     string        `yaml:"posts_category"`
+	RefreshInterval   time.Duration `yaml:"refresh_interval"`
+	RateLimitLow      int           `yaml:"rate_limit_low"`
+	RateLimitCritical int           `yaml:"rate_limit_critical"`
 }
 
 func (c GitHubConfig) String() string {
-	return fmt.Sprintf("\n  AccessToken: %s\n  User: %s",
+	return fmt.Sprintf("\n  AccessToken: %s\n  User: %s\n  PostsRepository: %s\n  PostsCategory: %s\n  RefreshInterval: %s\n  RateLimitLow: %d\n  RateLimitCritical: %d",
 		strings.Repeat("*", len(c.AccessToken)),
 		c.User,
+		c.PostsRepository,
+		c.PostsCategory,
+		c.RefreshInterval,
+		c.RateLimitLow,
+		c.RateLimitCritical,
 	)
 }
 
+func (c GitHubConfig) Validate() error {
+	errs := []error{
+		required("github.access_token", c.AccessToken),
+		required("github.user", c.User),
+	}
+	if c.PostsCategory != "" && c.PostsRepository == "" {
+		errs = append(errs, errors.New("github.posts_category requires github.posts_repository to be set"))
+	}
+	if c.RefreshInterval < 0 {
+		errs = append(errs, fmt.Errorf("github.refresh_interval must not be negative, got %s", c.RefreshInterval))
+	} else if c.RefreshInterval > 0 && c.RefreshInterval < 10*time.Second {
+		errs = append(errs, fmt.Errorf("github.refresh_interval must be at least 10s to stay within the GitHub rate limit, got %s", c.RefreshInterval))
+	}
+	if c.RateLimitLow < 0 || c.RateLimitCritical < 0 {
+		errs = append(errs, fmt.Errorf("github.rate_limit_low and github.rate_limit_critical must not be negative, got %d and %d", c.RateLimitLow, c.RateLimitCritical))
+	} else if c.RateLimitCritical > c.RateLimitLow {
+		errs = append(errs, fmt.Errorf("github.rate_limit_critical (%d) must not exceed github.rate_limit_low (%d)", c.RateLimitCritical, c.RateLimitLow))
+	}
+	return errors.Join(errs...)
+}
+
+// Identity identifies the data fetched with c, persisted data of another identity must not be served.
+func (c GitHubConfig) Identity() string {
+	return c.User + "/" + c.PostsRepository + "#" + c.PostsCategory
+}
+
 type CacheConfig struct {
 	Size int           `yaml:"size"`
 	TTL  time.Duration `yaml:"ttl"`
@@ -85,18 +470,200 @@ func (c CacheConfig) String() string {
 	)
 }
 
+// maxRecentTracks keeps the recently played list short enough to fit next to the current track.
+const maxRecentTracks = 50
+
+var DefaultLastFMConfig = LastFMConfig{
+	RecentTracks: 5,
+}
+
 type LastFMConfig struct {
-	Username string        `yaml:"username"`
-	APIKey   string        `yaml:"api_key"`
-	Size     int           `yaml:"size"`
-	TTL      time.Duration `yaml:"ttl"`
+	Username     string        `yaml:"username"`
+	APIKey       string        `yaml:"api_key"`
+	RecentTracks int           `yaml:"recent_tracks"`
+	Size         int           `yaml:"size"`
+	TTL          time.Duration `yaml:"ttl"`
 }
 
 func (c LastFMConfig) String() string {
-	return fmt.Sprintf("\n  Username: %s\n  APIKey: %s\n  Size: %d\n  TTL: %s",
+	return fmt.Sprintf("\n  Username: %s\n  APIKey: %s\n  RecentTracks: %d\n  Size: %d\n  TTL: %s",
 		c.Username,
 		strings.Repeat("*", len(c.APIKey)),
+		c.RecentTracks,
 		c.Size,
 		c.TTL,
 	)
 }
+
+func (c LastFMConfig) Validate() error {
+	errs := []error{
+		required("lastfm.username", c.Username),
+		required("lastfm.api_key", c.APIKey),
+		validateCache("lastfm", c.Size, c.TTL),
+	}
+	if c.RecentTracks < 0 || c.RecentTracks > maxRecentTracks {
+		errs = append(errs, fmt.Errorf("lastfm.recent_tracks must be between 0 and %d, got %d", maxRecentTracks, c.RecentTracks))
+	}
+	return errors.Join(errs...)
+}
+
+type OtelConfig struct {
+	Endpoint string `yaml:"endpoint"`
+	Insecure bool   `yaml:"insecure"`
+}
+
+func (c OtelConfig) String() string {
+	return fmt.Sprintf("\n  Endpoint: %s\n  Insecure: %t",
+		c.Endpoint,
+		c.Insecure,
+	)
+}
+
+// DefaultCacheControlConfig returns the policies used unless the config overrides them.
+// Routes from the config are added to these.
+func DefaultCacheControlConfig() CacheControlConfig {
+	return CacheControlConfig{
+		"/assets/*": {MaxAge: 24 * time.Hour},
+	}
+}
+
+// CacheControlConfig maps chi route patterns like /posts/{number} to their Cache-Control policy.
+// Routes without a policy are sent with no-cache.
+type CacheControlConfig map[string]CacheControlPolicy
+
+func (c CacheControlConfig) String() string {
+	routes := make([]string, 0, len(c))
+	for route := range c {
+		routes = append(routes, route)
+	}
+	slices.Sort(routes)
+
+	var str string
+	for _, route := range routes {
+		str += fmt.Sprintf("\n  %s: %s", route, c[route])
+	}
+	return str
+}
+
+func (c CacheControlConfig) Validate() error {
+	var errs []error
+	for route, policy := range c {
+		if !strings.HasPrefix(route, "/") {
+			errs = append(errs, fmt.Errorf("cache_control route %q must start with /", route))
+		}
+		if err := policy.Validate(route); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+type CacheControlPolicy struct {
+	MaxAge               time.Duration `yaml:"max_age"`
+	SMaxAge              time.Duration `yaml:"s_maxage"`
+	StaleWhileRevalidate time.Duration `yaml:"stale_while_revalidate"`
+	StaleIfError         time.Duration `yaml:"stale_if_error"`
+}
+
+// String returns the Cache-Control header value of the policy.
+func (p CacheControlPolicy) String() string {
+	if p == (CacheControlPolicy{}) {
+		return "no-cache"
+	}
+
+	directives := []string{"public", fmt.Sprintf("max-age=%d", int(p.MaxAge.Seconds()))}
+	for _, directive := range []struct {
+		name  string
+		value time.Duration
+	}{
+		{"s-maxage", p.SMaxAge},
+		{"stale-while-revalidate", p.StaleWhileRevalidate},
+		{"stale-if-error", p.StaleIfError},
+	} {
+		if directive.value > 0 {
+			directives = append(directives, fmt.Sprintf("%s=%d", directive.name, int(directive.value.Seconds())))
+		}
+	}
+	return strings.Join(directives, ", ")
+}
+
+func (p CacheControlPolicy) Validate(route string) error {
+	var errs []error
+	for _, value := range []struct {
+		name  string
+		value time.Duration
+	}{
+		{"max_age", p.MaxAge},
+		{"s_maxage", p.SMaxAge},
+		{"stale_while_revalidate", p.StaleWhileRevalidate},
+		{"stale_if_error", p.StaleIfError},
+	} {
+		if value.value < 0 {
+			errs = append(errs, fmt.Errorf("cache_control[%s].%s must not be negative, got %s", route, value.name, value.value))
+		} else if value.value%time.Second != 0 {
+			errs = append(errs, fmt.Errorf("cache_control[%s].%s must be a whole number of seconds, got %s", route, value.name, value.value))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+var DefaultRetryConfig = RetryConfig{
+	Attempts:       3,
+	InitialBackoff: 200 * time.Millisecond,
+	MaxBackoff:     5 * time.Second,
+}
+
+type RetryConfig struct {
+	Attempts       int           `yaml:"attempts"`
+	InitialBackoff time.Duration `yaml:"initial_backoff"`
+	MaxBackoff     time.Duration `yaml:"max_backoff"`
+}
+
+func (c RetryConfig) String() string {
+	return fmt.Sprintf("\n  Attempts: %d\n  InitialBackoff: %s\n  MaxBackoff: %s",
+		c.Attempts,
+		c.InitialBackoff,
+		c.MaxBackoff,
+	)
+}
+
+func (c RetryConfig) Validate() error {
+	var errs []error
+	if c.Attempts < 1 {
+		errs = append(errs, fmt.Errorf("retry.attempts must be at least 1 (1 disables retries), got %d", c.Attempts))
+	}
+	if c.InitialBackoff <= 0 || c.MaxBackoff <= 0 {
+		errs = append(errs, fmt.Errorf("retry.initial_backoff and retry.max_backoff must be positive, got %s and %s", c.InitialBackoff, c.MaxBackoff))
+	} else if c.InitialBackoff > c.MaxBackoff {
+		errs = append(errs, fmt.Errorf("retry.initial_backoff (%s) must not exceed retry.max_backoff (%s)", c.InitialBackoff, c.MaxBackoff))
+	}
+	return errors.Join(errs...)
+}
+
+var DefaultCircuitBreakerConfig = CircuitBreakerConfig{
+	Failures: 5,
+	Cooldown: 30 * time.Second,
+}
+
+type CircuitBreakerConfig struct {
+	Failures int           `yaml:"failures"`
+	Cooldown time.Duration `yaml:"cooldown"`
+}
+
+func (c CircuitBreakerConfig) String() string {
+	return fmt.Sprintf("\n  Failures: %d\n  Cooldown: %s",
+		c.Failures,
+		c.Cooldown,
+	)
+}
+
+func (c CircuitBreakerConfig) Validate() error {
+	var errs []error
+	if c.Failures < 1 {
+		errs = append(errs, fmt.Errorf("circuit_breaker.failures must be at least 1, got %d", c.Failures))
+	}
+	if c.Cooldown <= 0 {
+		errs = append(errs, fmt.Errorf("circuit_breaker.cooldown must be positive, got %s", c.Cooldown))
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,208 @@
+package topi
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gorilla/feeds"
+)
+
+type FeedFormat string
+
+const (
+	FeedFormatAtom FeedFormat = "atom"
+	FeedFormatRSS  FeedFormat = "rss"
+	FeedFormatJSON FeedFormat = "json"
+)
+
+const JSONFeedVersion = "https://jsonfeed.org/version/1.1"
+
+// JSONFeed is a feed following the JSON Feed 1.1 spec, see https://www.jsonfeed.org/version/1.1/.
+type JSONFeed struct {
+	Version     string           `json:"version"`
+	Title       string           `json:"title"`
+	HomePageURL string           `json:"home_page_url,omitempty"`
+	FeedURL     string           `json:"feed_url,omitempty"`
+	Description string           `json:"description,omitempty"`
+	Icon        string           `json:"icon,omitempty"`
+	Authors     []JSONFeedAuthor `json:"authors,omitempty"`
+	Items       []JSONFeedItem   `json:"items"`
+}
+
+type JSONFeedAuthor struct {
+	Name   string `json:"name,omitempty"`
+	URL    string `json:"url,omitempty"`
+	Avatar string `json:"avatar,omitempty"`
+}
+
+type JSONFeedItem struct {
+	ID            string           `json:"id"`
+	URL           string           `json:"url,omitempty"`
+	ExternalURL   string           `json:"external_url,omitempty"`
+	Title         string           `json:"title,omitempty"`
+	ContentHTML   string           `json:"content_html,omitempty"`
+	ContentText   string           `json:"content_text,omitempty"`
+	DatePublished *time.Time       `json:"date_published,omitempty"`
+	DateModified  *time.Time       `json:"date_modified,omitempty"`
+	Authors       []JSONFeedAuthor `json:"authors,omitempty"`
+	Tags          []string         `json:"tags,omitempty"`
+}
+
+func (s *Server) feed(format FeedFormat) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		vars, err := s.SiteData(ctx)
+		if err != nil {
+			s.error(w, r, err, http.StatusInternalServerError)
+			return
+		}
+
+		setLastModified(w, lastModified(vars))
+		switch format {
+		case FeedFormatAtom:
+			w.Header().Set("Content-Type", "application/atom+xml; charset=utf-8")
+			err = newFeed(s.baseURL(), vars).WriteAtom(w)
+		case FeedFormatRSS:
+			w.Header().Set("Content-Type", "application/rss+xml; charset=utf-8")
+			err = newFeed(s.baseURL(), vars).WriteRss(w)
+		case FeedFormatJSON:
+			w.Header().Set("Content-Type", "application/feed+json; charset=utf-8")
+			err = json.NewEncoder(w).Encode(newJSONFeed(s.baseURL(), vars))
+		}
+		if err != nil {
+			slog.ErrorContext(ctx, "failed to write feed", slog.Any("error", err), slog.String("format", string(format)))
+		}
+	}
+}
+
+func newFeed(baseURL string, vars *Variables) *feeds.Feed {
+	author := &feeds.Author{Name: vars.User.Name}
+
+	feed := &feeds.Feed{
+		Title:       vars.User.Name,
+		Link:        &feeds.Link{Href: baseURL + "/"},
+		Description: vars.Description,
+		Author:      author,
+		Id:          baseURL + "/",
+		Image: &feeds.Image{
+			Url:   string(vars.User.AvatarURL),
+			Title: vars.User.Name,
+			Link:  baseURL + "/",
+		},
+	}
+
+	var updated time.Time
+	for _, post := range vars.Posts {
+		link := fmt.Sprintf("%s/posts/%d", baseURL, post.Number)
+		feed.Items = append(feed.Items, &feeds.Item{
+			Id:      link,
+			Title:   post.Title,
+			Link:    &feeds.Link{Href: link},
+			Author:  author,
+			Created: post.CreatedAt,
+			Content: string(post.Content),
+		})
+		if post.CreatedAt.After(updated) {
+			updated = post.CreatedAt
+		}
+	}
+	feed.Created = updated
+	feed.Updated = updated
+
+	return feed
+}
+
+func newJSONFeed(baseURL string, vars *Variables) JSONFeed {
+	author := JSONFeedAuthor{
+		Name:   vars.User.Name,
+		URL:    "https://github.com/" + vars.User.Name,
+		Avatar: string(vars.User.AvatarURL),
+	}
+
+	items := make([]JSONFeedItem, 0, len(vars.Posts)+len(vars.Projects))
+	for _, post := range vars.Posts {
+		createdAt := post.CreatedAt
+		link := fmt.Sprintf("%s/posts/%d", baseURL, post.Number)
+		item := JSONFeedItem{
+			ID:            link,
+			URL:           link,
+			ExternalURL:   string(post.URL),
+			Title:         post.Title,
+			ContentHTML:   string(post.Content),
+			DatePublished: &createdAt,
+			Authors:       []JSONFeedAuthor{author},
+			Tags:          []string{"post"},
+		}
+		// JSON Feed requires every item to have content
+		if item.ContentHTML == "" {
+			item.ContentText = post.Title
+		}
+		items = append(items, item)
+	}
+
+	for _, project := range vars.Projects {
+		// a project gets a new item for every push, so readers pick up activity on it
+		updatedAt := project.UpdatedAt
+		tags := make([]string, 0, len(project.Topics)+1)
+		tags = append(tags, "project")
+		for _, topic := range project.Topics {
+			tags = append(tags, topic.Name)
+		}
+		items = append(items, JSONFeedItem{
+			ID:            fmt.Sprintf("%s#%s", project.URL, updatedAt.UTC().Format(time.RFC3339)),
+			URL:           string(project.URL),
+			Title:         project.Name,
+			ContentText:   projectText(project),
+			DatePublished: &updatedAt,
+			DateModified:  &updatedAt,
+			Authors:       []JSONFeedAuthor{author},
+			Tags:          tags,
+		})
+	}
+
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].DatePublished.After(*items[j].DatePublished)
+	})
+
+	return JSONFeed{
+		Version:     JSONFeedVersion,
+		Title:       vars.User.Name,
+		HomePageURL: baseURL + "/",
+		FeedURL:     baseURL + "/feed.json",
+		Description: vars.Description,
+		Icon:        string(vars.User.AvatarURL),
+		Authors:     []JSONFeedAuthor{author},
+		Items:       items,
+	}
+}
+
+// projectText describes project for feed readers. JSON Feed requires every item to have content,
+// so repositories without a description are described by their name, language and topics.
+func projectText(project Project) string {
+	if project.Description != "" {
+		return project.Description
+	}
+	text := project.Name
+	if project.Language != nil {
+		text += " is written in " + project.Language.Name
+	}
+	if len(project.Topics) > 0 {
+		topics := make([]string, 0, len(project.Topics))
+		for _, topic := range project.Topics {
+			topics = append(topics, topic.Name)
+		}
+		text += " (" + strings.Join(topics, ", ") + ")"
+	}
+	return text
+}
+
+// baseURL returns the configured public url without a trailing slash.
+// It is never derived from the request, since responses using it are cached publicly.
+func (s *Server) baseURL() string {
+	return strings.TrimSuffix(s.cfg.PublicURL, "/")
+}
@@ -5,6 +5,8 @@ import (
 	"context"
 	"fmt"
 	"html/template"
+	"log/slog"
+	"net/http"
 	"time"
 
 	"github.com/shurcooL/githubv4"
@@ -39,6 +41,83 @@ type Repositories struct {
 	}
 }
 
+// upstreamResponseKey is the context key of the *upstreamResponse filled in by RecordResponses.
+type upstreamResponseKey struct{}
+
+type upstreamResponse struct {
+	statusCode int
+}
+
+// RecordResponses wraps base so that query can tell whether GitHub answered a request at all.
+func RecordResponses(base http.RoundTripper) http.RoundTripper {
+	return roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		rs, err := base.RoundTrip(r)
+		if recorded, ok := r.Context().Value(upstreamResponseKey{}).(*upstreamResponse); ok && rs != nil {
+			recorded.statusCode = rs.StatusCode
+		}
+		return rs, err
+	})
+}
+
+// GraphQLError is returned by query when GitHub answered fine but reported errors for the query itself,
+// for example because it asked for something which doesn't exist.
+type GraphQLError struct {
+	Err error
+}
+
+func (e *GraphQLError) Error() string {
+	return fmt.Sprintf("github: %s", e.Err)
+}
+
+func (e *GraphQLError) Unwrap() error {
+	return e.Err
+}
+
+// GitHubStatusError is returned by query when GitHub answered with a status other than 200 OK.
+type GitHubStatusError struct {
+	StatusCode int
+	Err        error
+}
+
+func (e *GitHubStatusError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *GitHubStatusError) Unwrap() error {
+	return e.Err
+}
+
+// query runs a GitHub GraphQL query and records its duration and outcome as operation.
+// Only transport errors and non-200 responses count as failures of GitHub, errors in an answer are returned as GraphQLError.
+func (s *Server) query(ctx context.Context, operation string, q any, variables map[string]any) error {
+	return traced(ctx, "github."+operation, func(ctx context.Context) error {
+		var queryErr error
+		if err := s.breakers[UpstreamGitHub].Do(ctx, func(ctx context.Context) error {
+			start := time.Now()
+			var rs upstreamResponse
+			queryErr = s.githubClient.Query(context.WithValue(ctx, upstreamResponseKey{}, &rs), q, variables)
+			s.metrics.ObserveUpstream(UpstreamGitHub, operation, start, queryErr)
+			if limited, ok := q.(interface{ rateLimit() RateLimit }); ok {
+				s.observeRateLimit(ctx, operation, limited.rateLimit())
+			}
+			if queryErr != nil && rs.statusCode == http.StatusOK {
+				// GitHub answered, so it is healthy even though the query asked for something which doesn't exist
+				s.health.Report(ComponentGitHub, nil)
+				queryErr = &GraphQLError{Err: queryErr}
+				return nil
+			}
+			if queryErr != nil && rs.statusCode != 0 {
+				queryErr = &GitHubStatusError{StatusCode: rs.statusCode, Err: queryErr}
+			}
+			s.health.Report(ComponentGitHub, queryErr)
+			return queryErr
+		}); err != nil {
+			return err
+		}
+		return queryErr
+	})
+}
+
 func parseRepositories(repositories Repositories) []Project {
 	projects := make([]Project, 0, len(repositories.Nodes))
 	for _, node := range repositories.Nodes {
@@ -76,6 +155,7 @@ func parseRepositories(repositories Repositories) []Project {
 
 func (s *Server) FetchData(ctx context.Context) (*Variables, error) {
 	var query struct {
+		RateLimited
 		User struct {
 			Login      string
 			AvatarURL  string
@@ -103,7 +183,7 @@ func (s *Server) FetchData(ctx context.Context) (*Variables, error) {
 		"topics":       githubv4.Int(10),
 		"expression":   githubv4.String("HEAD:"),
 	}
-	if err := s.githubClient.Query(ctx, &query, variables); err != nil {
+	if err := s.query(ctx, "data", &query, variables); err != nil {
 		return nil, err
 	}
 
@@ -124,18 +204,98 @@ func (s *Server) FetchData(ctx context.Context) (*Variables, error) {
 		projectsAfter = ""
 	}
 
-	return &Variables{
+	vars := &Variables{
 		User:          user,
 		Home:          home,
 		Projects:      parseRepositories(query.User.Repositories),
 		ProjectsAfter: projectsAfter,
 		Dark:          true,
 		Description:   query.User.Repository.Description,
-	}, nil
+		FetchedAt:     time.Now(),
+	}
+
+	if s.cfg.GitHub.PostsRepository != "" {
+		postVars, err := s.FetchPosts(ctx, "")
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch posts: %w", err)
+		}
+		vars.Posts = postVars.Posts
+		vars.PostsAfter = postVars.PostsAfter
+	}
+
+	return vars, nil
+}
+
+// SiteData returns the highlighted data of the index page. With a refresh interval configured it is served from the
+// in-memory snapshot and marked as stale if the latest refresh failed, otherwise it is fetched on every call.
+// The returned Variables may share slices with other requests and must not be modified beyond its top level fields.
+func (s *Server) SiteData(ctx context.Context) (*Variables, error) {
+	if s.refresher == nil {
+		return s.fetchSiteData(ctx)
+	}
+
+	snapshot, err := s.refresher.Load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if snapshot == nil || snapshot.Vars == nil {
+		return nil, ErrNoSnapshot
+	}
+
+	vars := *snapshot.Vars
+	if snapshot.Stale() {
+		vars.StaleSince = snapshot.FetchedAt
+	}
+	vars.Degraded = s.breakers[UpstreamGitHub].Open()
+	return &vars, nil
+}
+
+// fetchSiteData fetches the site data live and falls back to the last stored snapshot if that fails.
+func (s *Server) fetchSiteData(ctx context.Context) (*Variables, error) {
+	vars, err := cached(ctx, s.cache, "site", func(ctx context.Context) (*Variables, error) {
+		generation := s.snapshots.Generation()
+		vars, err := s.fetchSnapshot(ctx)
+		if err != nil {
+			return nil, err
+		}
+		s.snapshots.Store(generation, &Snapshot{
+			Vars:      vars,
+			FetchedAt: time.Now(),
+		})
+		return vars, nil
+	})
+	if err == nil {
+		// the cached data is shared between requests, so hand out a copy
+		siteVars := *vars
+		return &siteVars, nil
+	}
+
+	snapshot := s.snapshots.Load()
+	if snapshot == nil || snapshot.Vars == nil {
+		return nil, err
+	}
+	slog.WarnContext(ctx, "failed to fetch data, serving the last snapshot", slog.Any("error", err))
+	staleVars := *snapshot.Vars
+	staleVars.StaleSince = snapshot.FetchedAt
+	staleVars.Degraded = s.breakers[UpstreamGitHub].Open()
+	return &staleVars, nil
+}
+
+func (s *Server) fetchSnapshot(ctx context.Context) (*Variables, error) {
+	vars, err := s.FetchData(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch data: %w", err)
+	}
+
+	if err = s.HighlightData(ctx, vars); err != nil {
+		return nil, fmt.Errorf("failed to highlight data: %w", err)
+	}
+	return vars, nil
 }
 
 func (s *Server) FetchRepositories(ctx context.Context, after string) (*Variables, error) {
 	var query struct {
+		RateLimited
 		User struct {
 			Repositories Repositories `graphql:"repositories(after: $after, first: $repositories, isFork: false, privacy: PUBLIC, orderBy: {field: PUSHED_AT, direction: DESC})"`
 		} `graphql:"user(login: $user)"`
@@ -146,7 +306,7 @@ func (s *Server) FetchRepositories(ctx context.Context, after string) (*Variable
 		"topics":       githubv4.Int(10),
 		"after":        githubv4.String(after),
 	}
-	if err := s.githubClient.Query(ctx, &query, variables); err != nil {
+	if err := s.query(ctx, "repositories", &query, variables); err != nil {
 		return nil, err
 	}
 
@@ -158,10 +318,17 @@ func (s *Server) FetchRepositories(ctx context.Context, after string) (*Variable
 	return &Variables{
 		Projects:      parseRepositories(query.User.Repositories),
 		ProjectsAfter: after,
+		FetchedAt:     time.Now(),
 	}, nil
 }
 
-func (s *Server) HighlightData(vars *Variables) error {
+func (s *Server) HighlightData(ctx context.Context, vars *Variables) error {
+	return traced(ctx, "markdown.highlight", func(ctx context.Context) error {
+		return s.highlightData(vars)
+	})
+}
+
+func (s *Server) highlightData(vars *Variables) error {
 	buff := new(bytes.Buffer)
 	if err := s.md.Convert([]byte(vars.Home.Body), buff); err != nil {
 		return fmt.Errorf("failed to format home: %w", err)
@@ -169,31 +336,53 @@ func (s *Server) HighlightData(vars *Variables) error {
 	vars.Home.Content = template.HTML(buff.String())
 	buff.Reset()
 
-	for i, post := range vars.Posts {
-		for ii, comment := range post.Comments {
-			for iii, reply := range comment.Replies {
-				if err := s.md.Convert([]byte(reply.Body), buff); err != nil {
-					return fmt.Errorf("failed to format reply: %w", err)
-				}
-				vars.Posts[i].Comments[ii].Replies[iii].Content = template.HTML(buff.String())
-				buff.Reset()
-			}
+	for i := range vars.Posts {
+		if err := s.HighlightPost(&vars.Posts[i]); err != nil {
+			return err
+		}
+	}
 
-			if err := s.md.Convert([]byte(comment.Body), buff); err != nil {
-				return fmt.Errorf("failed to format comment: %w", err)
-			}
-			post.Comments[ii].Content = template.HTML(buff.String())
-			buff.Reset()
+	if vars.Post != nil {
+		if err := s.HighlightPost(vars.Post); err != nil {
+			return err
 		}
+	}
+
+	vars.CSS = template.CSS(buff.String())
+
+	return nil
+}
 
-		if err := s.md.Convert([]byte(post.Body), buff); err != nil {
-			return fmt.Errorf("failed to format post: %w", err)
+func (s *Server) HighlightPost(post *Post) error {
+	buff := new(bytes.Buffer)
+	for i := range post.Comments {
+		if err := s.HighlightComment(&post.Comments[i]); err != nil {
+			return err
 		}
-		vars.Posts[i].Content = template.HTML(buff.String())
+	}
+
+	if err := s.md.Convert([]byte(post.Body), buff); err != nil {
+		return fmt.Errorf("failed to format post: %w", err)
+	}
+	post.Content = template.HTML(buff.String())
+
+	return nil
+}
+
+func (s *Server) HighlightComment(comment *Comment) error {
+	buff := new(bytes.Buffer)
+	for i, reply := range comment.Replies {
+		if err := s.md.Convert([]byte(reply.Body), buff); err != nil {
+			return fmt.Errorf("failed to format reply: %w", err)
+		}
+		comment.Replies[i].Content = template.HTML(buff.String())
 		buff.Reset()
 	}
 
-	vars.CSS = template.CSS(buff.String())
+	if err := s.md.Convert([]byte(comment.Body), buff); err != nil {
+		return fmt.Errorf("failed to format comment: %w", err)
+	}
+	comment.Content = template.HTML(buff.String())
 
 	return nil
 }
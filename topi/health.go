@@ -0,0 +1,269 @@
+package topi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	ComponentGitHub      = "github"
+	ComponentGitHubToken = "github_token"
+	ComponentLastFM      = "lastfm"
+	ComponentTemplates   = "templates"
+)
+
+const (
+	HealthStatusOK      = "ok"
+	HealthStatusUnknown = "unknown"
+	HealthStatusError   = "error"
+)
+
+// tokenCheckInterval limits how often the GitHub token is verified, so probes don't eat into the rate limit.
+const tokenCheckInterval = time.Minute
+
+// tokenCheckMaxBackoff caps how long failed token checks are backed off.
+const tokenCheckMaxBackoff = 15 * time.Minute
+
+// tokenCheckTimeout bounds a single token check.
+const tokenCheckTimeout = 10 * time.Second
+
+// githubReadyIntervals is how many refresh intervals may pass without GitHub answering before the instance is unready.
+const githubReadyIntervals = 3
+
+// githubReadyWindow is used instead when the data isn't refreshed in the background.
+const githubReadyWindow = 5 * time.Minute
+
+// criticalComponents fail the readiness check when they are unhealthy.
+// Last.fm only powers a widget, so an outage there doesn't make the instance unready.
+var criticalComponents = map[string]bool{
+	ComponentGitHub:      true,
+	ComponentGitHubToken: true,
+	ComponentLastFM:      false,
+	ComponentTemplates:   true,
+}
+
+func NewHealth() *Health {
+	return &Health{
+		components: map[string]*ComponentHealth{},
+	}
+}
+
+// Health tracks the outcome of the latest calls to each component.
+type Health struct {
+	mu         sync.Mutex
+	components map[string]*ComponentHealth
+}
+
+type ComponentHealth struct {
+	Status      string     `json:"status"`
+	Critical    bool       `json:"critical"`
+	LastSuccess *time.Time `json:"last_success,omitempty"`
+	LastError   *time.Time `json:"last_error,omitempty"`
+	Error       string     `json:"error,omitempty"`
+}
+
+type HealthResponse struct {
+	Status          string                     `json:"status"`
+	Components      map[string]ComponentHealth `json:"components,omitempty"`
+	CircuitBreakers map[string]BreakerStatus   `json:"circuit_breakers,omitempty"`
+}
+
+// Report records the outcome of a call to component.
+func (h *Health) Report(component string, err error) {
+	now := time.Now()
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	c, ok := h.components[component]
+	if !ok {
+		c = &ComponentHealth{}
+		h.components[component] = c
+	}
+
+	if err != nil {
+		c.Status = HealthStatusError
+		c.LastError = &now
+		c.Error = err.Error()
+		return
+	}
+	c.Status = HealthStatusOK
+	c.LastSuccess = &now
+	c.Error = ""
+}
+
+// Reset forgets everything known about component.
+func (h *Health) Reset(component string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.components, component)
+}
+
+// tokenChecker schedules the GitHub token checks, which run in the background so readiness probes never wait on GitHub.
+type tokenChecker struct {
+	mu       sync.Mutex
+	running  bool
+	next     time.Time
+	failures int
+}
+
+// start reports whether a check is due and marks it as running.
+func (c *tokenChecker) start() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.running || time.Now().Before(c.next) {
+		return false
+	}
+	c.running = true
+	return true
+}
+
+// done schedules the next check. Failed checks are backed off exponentially.
+func (c *tokenChecker) done(failed bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.running = false
+	wait := tokenCheckInterval
+	if failed {
+		c.failures++
+		wait = tokenCheckMaxBackoff
+		if shift := c.failures - 1; shift < 8 {
+			wait = min(tokenCheckInterval<<shift, tokenCheckMaxBackoff)
+		}
+	} else {
+		c.failures = 0
+	}
+	c.next = time.Now().Add(wait)
+}
+
+func (h *Health) Snapshot(tolerate func(component string, c ComponentHealth) bool) HealthResponse {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	status := HealthStatusOK
+	components := make(map[string]ComponentHealth, len(criticalComponents))
+	for name, critical := range criticalComponents {
+		c := ComponentHealth{Status: HealthStatusUnknown}
+		if reported, ok := h.components[name]; ok {
+			c = *reported
+		}
+		c.Critical = critical
+		if critical && c.Status == HealthStatusError && (tolerate == nil || !tolerate(name, c)) {
+			status = HealthStatusError
+		}
+		components[name] = c
+	}
+
+	return HealthResponse{
+		Status:     status,
+		Components: components,
+	}
+}
+
+// reportRender records the outcome of a template execution. Errors caused by the client going away are ignored.
+func (h *Health) reportRender(ctx context.Context, err error) {
+	if err != nil && (ctx.Err() != nil || errors.Is(err, syscall.EPIPE) || errors.Is(err, syscall.ECONNRESET) || errors.Is(err, http.ErrHandlerTimeout)) {
+		return
+	}
+	h.Report(ComponentTemplates, err)
+}
+
+func (s *Server) healthz(w http.ResponseWriter, r *http.Request) {
+	writeHealth(w, r, http.StatusOK, HealthResponse{Status: HealthStatusOK})
+}
+
+func (s *Server) readyz(w http.ResponseWriter, r *http.Request) {
+	s.startTokenCheck()
+
+	health := s.health.Snapshot(s.tolerateGitHub)
+	health.CircuitBreakers = s.breakerStatuses()
+	status := http.StatusOK
+	if health.Status != HealthStatusOK {
+		status = http.StatusServiceUnavailable
+	}
+	writeHealth(w, r, status, health)
+}
+
+// startTokenCheck verifies the GitHub token in the background if a check is due.
+func (s *Server) startTokenCheck() {
+	if !s.tokenChecker.start() {
+		return
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), tokenCheckTimeout)
+		defer cancel()
+		answered, err := s.checkGitHubToken(ctx)
+		// only GitHub rejecting the token says something about it, an outage is tolerated by readyz
+		if answered {
+			s.health.Report(ComponentGitHubToken, err)
+		}
+		s.tokenChecker.done(err != nil)
+	}()
+}
+
+// checkGitHubToken runs the cheapest possible query to verify the GitHub token is still valid.
+// answered is false if GitHub couldn't be reached or failed on its own, in which case err says nothing about the token.
+func (s *Server) checkGitHubToken(ctx context.Context) (answered bool, err error) {
+	var query struct {
+		Viewer struct {
+			Login string
+		}
+	}
+	err = s.query(ctx, "viewer", &query, nil)
+	var (
+		gqlErr    *GraphQLError
+		statusErr *GitHubStatusError
+	)
+	switch {
+	case err == nil, errors.As(err, &gqlErr):
+		return true, err
+	case errors.As(err, &statusErr):
+		return statusErr.StatusCode == http.StatusUnauthorized || statusErr.StatusCode == http.StatusForbidden, err
+	}
+	return false, err
+}
+
+// tolerateGitHub keeps the instance ready while GitHub fails, as long as it answered recently
+// or there is a snapshot to serve stale data from.
+func (s *Server) tolerateGitHub(component string, c ComponentHealth) bool {
+	if component != ComponentGitHub {
+		return false
+	}
+	if snapshot := s.snapshots.Load(); snapshot != nil && snapshot.Vars != nil {
+		return true
+	}
+	window := githubReadyWindow
+	if s.cfg.GitHub.RefreshInterval > 0 {
+		window = githubReadyIntervals * s.cfg.GitHub.RefreshInterval
+	}
+	return c.LastSuccess != nil && time.Since(*c.LastSuccess) < window
+}
+
+func (s *Server) breakerStatuses() map[string]BreakerStatus {
+	statuses := make(map[string]BreakerStatus, len(s.breakers))
+	for upstream, breaker := range s.breakers {
+		statuses[upstream] = breaker.Status()
+	}
+	return statuses
+}
+
+// circuitBreakers shows the state of the circuit breaker of each upstream.
+func (s *Server) circuitBreakers(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(s.breakerStatuses()); err != nil {
+		slog.ErrorContext(r.Context(), "failed to write circuit breakers response", slog.Any("error", err))
+	}
+}
+
+func writeHealth(w http.ResponseWriter, r *http.Request, status int, health HealthResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(health); err != nil {
+		slog.ErrorContext(r.Context(), "failed to write health response", slog.Any("error", err))
+	}
+}
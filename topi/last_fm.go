@@ -2,103 +2,141 @@ package topi
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"net/http"
+	"log/slog"
+	"time"
+
+	"github.com/topi314/topi.wtf/lastfm"
 )
 
 type LastFM struct {
-	Track *LastFMTrack
-	URL   string
-	Error string
+	Track       *LastFMTrack
+	Recent      []LastFMTrack
+	URL         string
+	Error       string
+	FetchedAt   time.Time
+	StaleSince  time.Time
+	Unavailable bool
 }
 
 type LastFMTrack struct {
-	Name      string
-	Artist    string
-	ArtistURL string
-	Album     string
-	Artwork   string
-	URL       string
-	Loved     bool
+	Name       string
+	Artist     string
+	ArtistURL  string
+	Album      string
+	Artwork    string
+	URL        string
+	Loved      bool
+	NowPlaying bool
+	PlayedAt   time.Time
 }
 
-type LastFMResponse struct {
-	RecentTracks struct {
-		Track []struct {
-			Artist struct {
-				URL   string `json:"url"`
-				Name  string `json:"name"`
-				Image Image  `json:"image"`
-				MbID  string `json:"mbid"`
-			} `json:"artist"`
-			Date struct {
-				Uts  int64  `json:"uts,string"`
-				Text string `json:"#text"`
-			} `json:"date"`
-			MbID       string `json:"mbid"`
-			Name       string `json:"name"`
-			Image      Image  `json:"image"`
-			URL        string `json:"url"`
-			Streamable int    `json:"streamable,string"`
-			Album      struct {
-				MbID string `json:"mbid"`
-				Text string `json:"#text"`
+func (s *Server) FetchLastFM(ctx context.Context) LastFM {
+	var lastFM LastFM
+	err := traced(ctx, "lastfm.recent_tracks", func(ctx context.Context) error {
+		return s.breakers[UpstreamLastFM].Do(ctx, func(ctx context.Context) error {
+			start := time.Now()
+			var err error
+			lastFM, err = s.fetchLastFM(ctx)
+			if err != nil {
+				slog.ErrorContext(ctx, "failed to fetch lastfm", slog.Any("error", err))
+				lastFM.Error = lastfm.Message(err)
+			}
+			s.metrics.ObserveUpstream(UpstreamLastFM, "recent_tracks", start, err)
+			if err != nil && !lastFMFailed(err) {
+				// Last.fm answered, so it is healthy even though it rejected the api key or the user
+				s.health.Report(ComponentLastFM, nil)
+				return nil
 			}
-			Loved int `json:"loved,string"`
-			Attr  struct {
-				NowPlaying string `json:"nowplaying"`
-			} `json:"@attr"`
+			s.health.Report(ComponentLastFM, err)
+			return err
+		})
+	})
+	if errors.Is(err, ErrCircuitOpen) {
+		lastFM = LastFM{
+			URL:         fmt.Sprintf("https://www.last.fm/user/%s", s.cfg.LastFM.Username),
+			Error:       lastfm.Message(err),
+			Unavailable: true,
+		}
+	}
+
+	if s.disk == nil {
+		return lastFM
+	}
+	if lastFM.Error == "" {
+		if err := s.disk.SaveLastFM(s.cfg.LastFM.Username, lastFM); err != nil {
+			slog.ErrorContext(ctx, "failed to persist lastfm state", slog.Any("error", err))
 		}
-	} `json:"recenttracks"`
-	Attr struct {
-		User       string `json:"user"`
-		TotalPages int    `json:"totalPages,string"`
-		Page       int    `json:"page,string"`
-		Total      int    `json:"total,string"`
-		PerPage    int    `json:"perPage,string"`
-	} `json:"@attr"`
+		return lastFM
+	}
+
+	stored, err := s.disk.LoadLastFM(s.cfg.LastFM.Username)
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to load persisted lastfm state", slog.Any("error", err))
+		return lastFM
+	}
+	if stored == nil {
+		return lastFM
+	}
+	stored.StaleSince = stored.FetchedAt
+	stored.Unavailable = lastFM.Unavailable
+	return *stored
 }
 
-type Image []struct {
-	Size string `json:"size"`
-	Text string `json:"#text"`
+// lastFMFailed reports whether err means that Last.fm itself failed, either because it couldn't be reached or answered with a server error.
+// Errors caused by the request, like an invalid api key, an unknown user or a rate limit, don't count as failures.
+func lastFMFailed(err error) bool {
+	if errors.Is(err, lastfm.ErrUnavailable) {
+		return true
+	}
+	var (
+		apiErr    *lastfm.Error
+		statusErr *lastfm.StatusError
+	)
+	return !errors.As(err, &apiErr) && !errors.As(err, &statusErr)
 }
 
-func (s *Server) FetchLastFM(ctx context.Context) LastFM {
-	url := fmt.Sprintf("https://ws.audioscrobbler.com/2.0/?method=%s&user=%s&api_key=%s&format=%s&limit=%d&extended=%d", "user.getrecenttracks", s.cfg.LastFM.Username, s.cfg.LastFM.APIKey, "json", 1, 1)
-	rq, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
-	if err != nil {
-		return LastFM{Error: fmt.Sprintf("failed to create request: %s", err)}
+func (s *Server) fetchLastFM(ctx context.Context) (LastFM, error) {
+	lastFM := LastFM{
+		URL: fmt.Sprintf("https://www.last.fm/user/%s", s.cfg.LastFM.Username),
 	}
-	rs, err := s.httpClient.Do(rq)
+	recentTracks, err := s.lastFMClient.RecentTracks(ctx, s.cfg.LastFM.Username, s.cfg.LastFM.RecentTracks+1)
 	if err != nil {
-		return LastFM{Error: fmt.Sprintf("failed to do request: %s", err)}
+		return lastFM, err
 	}
-	defer rs.Body.Close()
 
-	var resp LastFMResponse
-	if err = json.NewDecoder(rs.Body).Decode(&resp); err != nil {
-		return LastFM{Error: fmt.Sprintf("failed to decode response: %s", err)}
+	// the track currently playing is returned on top of the limit
+	tracks := recentTracks.Track
+	if len(tracks) > s.cfg.LastFM.RecentTracks+1 {
+		tracks = tracks[:s.cfg.LastFM.RecentTracks+1]
 	}
-
-	var track *LastFMTrack
-	if len(resp.RecentTracks.Track) > 0 {
-		lastFmTrack := resp.RecentTracks.Track[0]
-		if lastFmTrack.Attr.NowPlaying == "true" {
-			track = &LastFMTrack{
-				Name:      lastFmTrack.Name,
-				Artist:    lastFmTrack.Artist.Name,
-				ArtistURL: lastFmTrack.Artist.URL,
-				Album:     lastFmTrack.Album.Text,
-				Artwork:   lastFmTrack.Image[len(lastFmTrack.Image)-1].Text,
-				URL:       lastFmTrack.URL,
-			}
+	for i, lastFmTrack := range tracks {
+		track := newLastFMTrack(lastFmTrack)
+		if i == 0 {
+			lastFM.Track = &track
+			continue
 		}
+		lastFM.Recent = append(lastFM.Recent, track)
 	}
+	lastFM.FetchedAt = time.Now()
+	return lastFM, nil
+}
 
-	return LastFM{
-		Track: track,
-		URL:   fmt.Sprintf("https://www.last.fm/user/%s", s.cfg.LastFM.Username),
+func newLastFMTrack(track lastfm.Track) LastFMTrack {
+	var playedAt time.Time
+	if track.Date != nil && track.Date.Uts > 0 {
+		playedAt = time.Unix(track.Date.Uts, 0)
+	}
+	return LastFMTrack{
+		Name:       track.Name,
+		Artist:     track.Artist.Name,
+		ArtistURL:  track.Artist.URL,
+		Album:      track.Album.Text,
+		Artwork:    track.Image.URL(lastfm.ImageSizeExtraLarge),
+		URL:        track.URL,
+		Loved:      track.IsLoved(),
+		NowPlaying: track.NowPlaying(),
+		PlayedAt:   playedAt,
 	}
 }
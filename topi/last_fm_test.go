@@ -0,0 +1,34 @@
+package topi
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/topi314/topi.wtf/lastfm"
+)
+
+func TestLastFMFailed(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "transport error", err: errors.New("dial tcp: connection refused"), want: true},
+		{name: "server error", err: &lastfm.StatusError{StatusCode: http.StatusBadGateway}, want: true},
+		{name: "service offline", err: &lastfm.Error{StatusCode: http.StatusOK, Code: lastfm.ErrorCodeServiceOffline}, want: true},
+		{name: "invalid api key", err: &lastfm.Error{StatusCode: http.StatusForbidden, Code: lastfm.ErrorCodeInvalidAPIKey}, want: false},
+		{name: "user not found", err: fmt.Errorf("wrapped: %w", &lastfm.Error{StatusCode: http.StatusNotFound, Code: lastfm.ErrorCodeInvalidParameters, Message: "User not found"}), want: false},
+		{name: "rate limited", err: &lastfm.StatusError{StatusCode: http.StatusTooManyRequests}, want: false},
+		{name: "client error", err: &lastfm.StatusError{StatusCode: http.StatusBadRequest}, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := lastFMFailed(tt.err); got != tt.want {
+				t.Fatalf("expected %t, got %t", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,176 @@
+package topi
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const (
+	UpstreamGitHub = "github"
+	UpstreamLastFM = "lastfm"
+)
+
+func NewMetrics() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "topi",
+			Name:      "http_request_duration_seconds",
+			Help:      "Duration of HTTP requests by route pattern.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"route", "method", "status"}),
+		cacheRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "topi",
+			Name:      "cache_requests_total",
+			Help:      "Number of lookups answered by the data cache, by cache and result (hit or miss).",
+		}, []string{"cache", "result"}),
+		upstreamDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "topi",
+			Name:      "upstream_request_duration_seconds",
+			Help:      "Duration of requests to upstream APIs.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"upstream", "operation"}),
+		upstreamErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "topi",
+			Name:      "upstream_errors_total",
+			Help:      "Number of failed requests to upstream APIs.",
+		}, []string{"upstream", "operation"}),
+		rateLimitRemaining: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: "topi",
+			Name:      "github_rate_limit_remaining",
+			Help:      "Remaining GitHub GraphQL rate limit points.",
+		}),
+		rateLimitLimit: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: "topi",
+			Name:      "github_rate_limit_limit",
+			Help:      "GitHub GraphQL rate limit points per hour.",
+		}),
+		rateLimitResetAt: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: "topi",
+			Name:      "github_rate_limit_reset_timestamp_seconds",
+			Help:      "Unix time at which the GitHub GraphQL rate limit resets.",
+		}),
+		breakerState: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: "topi",
+			Name:      "circuit_breaker_state",
+			Help:      "State of the circuit breaker of each upstream: 0 closed, 1 half open, 2 open.",
+		}, []string{"upstream"}),
+		rateLimitCost: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "topi",
+			Name:      "github_rate_limit_cost_total",
+			Help:      "GitHub GraphQL rate limit points spent by operation.",
+		}, []string{"operation"}),
+	}
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.requestDuration,
+		m.cacheRequests,
+		m.upstreamDuration,
+		m.upstreamErrors,
+		m.rateLimitRemaining,
+		m.rateLimitLimit,
+		m.rateLimitResetAt,
+		m.rateLimitCost,
+		m.breakerState,
+	)
+	return m
+}
+
+// Metrics holds all prometheus collectors of the server.
+// It outlives config reloads, so counters are not reset.
+type Metrics struct {
+	registry         *prometheus.Registry
+	requestDuration  *prometheus.HistogramVec
+	cacheRequests    *prometheus.CounterVec
+	upstreamDuration *prometheus.HistogramVec
+	upstreamErrors   *prometheus.CounterVec
+
+	rateLimitRemaining prometheus.Gauge
+	rateLimitLimit     prometheus.Gauge
+	rateLimitResetAt   prometheus.Gauge
+	rateLimitCost      *prometheus.CounterVec
+
+	breakerState *prometheus.GaugeVec
+}
+
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// Middleware records the request duration labeled with the matched chi route pattern.
+func (m *Metrics) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r)
+
+		route := routePattern(r)
+		if route == "" {
+			route = "unmatched"
+		}
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		m.requestDuration.WithLabelValues(route, r.Method, strconv.Itoa(status)).Observe(time.Since(start).Seconds())
+	})
+}
+
+// routePattern returns the chi route pattern matched by r or an empty string if no route matched.
+func routePattern(r *http.Request) string {
+	rctx := chi.RouteContext(r.Context())
+	if rctx == nil || len(rctx.RoutePatterns) == 0 {
+		return ""
+	}
+
+	// chi trims the trailing slash of patterns, which leaves the root route empty
+	if route := rctx.RoutePattern(); route != "" {
+		return route
+	}
+	return "/"
+}
+
+// ObserveCache counts whether a cache lookup was answered from the cache or had to fetch the data.
+func (m *Metrics) ObserveCache(name string, hit bool) {
+	result := "hit"
+	if !hit {
+		result = "miss"
+	}
+	m.cacheRequests.WithLabelValues(name, result).Inc()
+}
+
+// ObserveUpstream records the duration and the outcome of an upstream request started at start.
+func (m *Metrics) ObserveUpstream(upstream string, operation string, start time.Time, err error) {
+	m.upstreamDuration.WithLabelValues(upstream, operation).Observe(time.Since(start).Seconds())
+	if err != nil {
+		m.upstreamErrors.WithLabelValues(upstream, operation).Inc()
+	}
+}
+
+// ObserveRateLimit records the GitHub rate limit returned by operation.
+func (m *Metrics) ObserveRateLimit(operation string, rateLimit RateLimit) {
+	m.rateLimitRemaining.Set(float64(rateLimit.Remaining))
+	m.rateLimitLimit.Set(float64(rateLimit.Limit))
+	m.rateLimitResetAt.Set(float64(rateLimit.ResetAt.Unix()))
+	m.rateLimitCost.WithLabelValues(operation).Add(float64(rateLimit.Cost))
+}
+
+var breakerStateValues = map[string]float64{
+	BreakerStateClosed:   0,
+	BreakerStateHalfOpen: 1,
+	BreakerStateOpen:     2,
+}
+
+// ObserveBreaker records the state of the circuit breaker of upstream.
+func (m *Metrics) ObserveBreaker(upstream string, state string) {
+	m.breakerState.WithLabelValues(upstream).Set(breakerStateValues[state])
+}
@@ -9,12 +9,18 @@ type Variables struct {
 	User          User
 	Home          Home
 	Posts         []Post
+	Post          *Post
 	PostsAfter    string
 	Projects      []Project
 	ProjectsAfter string
 	Dark          bool
 	Description   string
 	CSS           template.CSS
+	StaleSince    time.Time
+	Degraded      bool
+	// FetchedAt is when the data was fetched from GitHub. Upvotes and edits have no timestamp of their own,
+	// so this is the latest point the content could have changed.
+	FetchedAt time.Time
 }
 
 type Home struct {
@@ -24,23 +30,28 @@ type Home struct {
 }
 
 type Post struct {
-	Title     string
-	CreatedAt time.Time
-	URL       template.URL
-	Content   template.HTML
-	Body      string
-	Upvotes   int
-	Comments  []Comment
+	Number        int
+	Title         string
+	CreatedAt     time.Time
+	URL           template.URL
+	Content       template.HTML
+	Body          string
+	Upvotes       int
+	Comments      []Comment
+	CommentsAfter string
+	CommentsCount int
 }
 
 type Comment struct {
-	Author    string
-	AvatarURL template.URL
-	CreatedAt time.Time
-	Upvotes   int
-	Content   template.HTML
-	Body      string
-	Replies   []Reply
+	ID           string
+	Author       string
+	AvatarURL    template.URL
+	CreatedAt    time.Time
+	Upvotes      int
+	Content      template.HTML
+	Body         string
+	Replies      []Reply
+	RepliesAfter string
 }
 
 type Reply struct {
@@ -0,0 +1,307 @@
+package topi
+
+import (
+	"context"
+	"errors"
+	"html/template"
+	"strings"
+	"time"
+
+	"github.com/shurcooL/githubv4"
+)
+
+var (
+	ErrPostNotFound    = errors.New("post not found")
+	ErrCommentNotFound = errors.New("comment not found")
+)
+
+type PageInfo struct {
+	EndCursor   string
+	HasNextPage bool
+}
+
+type Author struct {
+	Login     string
+	AvatarURL string
+}
+
+type Discussion struct {
+	Number      int
+	Title       string
+	URL         string
+	CreatedAt   time.Time
+	Body        string
+	UpvoteCount int
+	Comments    DiscussionComments `graphql:"comments(first: $comments)"`
+}
+
+// ListedDiscussion is a Discussion as shown in the posts listing, which only needs the number of comments.
+type ListedDiscussion struct {
+	Number      int
+	Title       string
+	URL         string
+	CreatedAt   time.Time
+	Body        string
+	UpvoteCount int
+	Comments    struct {
+		TotalCount int
+	}
+}
+
+type Discussions struct {
+	Nodes    []ListedDiscussion
+	PageInfo PageInfo
+}
+
+type DiscussionComments struct {
+	TotalCount int
+	Nodes      []struct {
+		ID          string
+		Author      Author
+		CreatedAt   time.Time
+		UpvoteCount int
+		Body        string
+		Replies     DiscussionReplies `graphql:"replies(first: $replies)"`
+	}
+	PageInfo PageInfo
+}
+
+type DiscussionReplies struct {
+	Nodes []struct {
+		Author    Author
+		CreatedAt time.Time
+		Body      string
+	}
+	PageInfo PageInfo
+}
+
+func parseDiscussions(discussions Discussions) []Post {
+	posts := make([]Post, 0, len(discussions.Nodes))
+	for _, node := range discussions.Nodes {
+		posts = append(posts, Post{
+			Number:        node.Number,
+			Title:         node.Title,
+			CreatedAt:     node.CreatedAt,
+			URL:           template.URL(node.URL),
+			Body:          node.Body,
+			Upvotes:       node.UpvoteCount,
+			CommentsCount: node.Comments.TotalCount,
+		})
+	}
+
+	return posts
+}
+
+func parseDiscussion(discussion Discussion) Post {
+	return Post{
+		Number:        discussion.Number,
+		Title:         discussion.Title,
+		CreatedAt:     discussion.CreatedAt,
+		URL:           template.URL(discussion.URL),
+		Body:          discussion.Body,
+		Upvotes:       discussion.UpvoteCount,
+		Comments:      parseDiscussionComments(discussion.Comments),
+		CommentsAfter: nextCursor(discussion.Comments.PageInfo),
+		CommentsCount: discussion.Comments.TotalCount,
+	}
+}
+
+func parseDiscussionComments(comments DiscussionComments) []Comment {
+	parsed := make([]Comment, 0, len(comments.Nodes))
+	for _, node := range comments.Nodes {
+		parsed = append(parsed, Comment{
+			ID:           node.ID,
+			Author:       node.Author.Login,
+			AvatarURL:    template.URL(node.Author.AvatarURL),
+			CreatedAt:    node.CreatedAt,
+			Upvotes:      node.UpvoteCount,
+			Body:         node.Body,
+			Replies:      parseDiscussionReplies(node.Replies),
+			RepliesAfter: nextCursor(node.Replies.PageInfo),
+		})
+	}
+
+	return parsed
+}
+
+func parseDiscussionReplies(replies DiscussionReplies) []Reply {
+	parsed := make([]Reply, 0, len(replies.Nodes))
+	for _, node := range replies.Nodes {
+		parsed = append(parsed, Reply{
+			Author:    node.Author.Login,
+			AvatarURL: template.URL(node.Author.AvatarURL),
+			CreatedAt: node.CreatedAt,
+			Body:      node.Body,
+		})
+	}
+
+	return parsed
+}
+
+func nextCursor(pageInfo PageInfo) string {
+	if !pageInfo.HasNextPage {
+		return ""
+	}
+	return pageInfo.EndCursor
+}
+
+func cursor(after string) *githubv4.String {
+	if after == "" {
+		return nil
+	}
+	return githubv4.NewString(githubv4.String(after))
+}
+
+func (s *Server) FetchPosts(ctx context.Context, after string) (*Variables, error) {
+	var query struct {
+		RateLimited
+		User struct {
+			Repository struct {
+				Discussions Discussions `graphql:"discussions(after: $after, first: $posts, categoryId: $category, orderBy: {field: CREATED_AT, direction: DESC})"`
+			} `graphql:"repository(name: $repository)"`
+		} `graphql:"user(login: $user)"`
+	}
+
+	var category *githubv4.ID
+	if s.cfg.GitHub.PostsCategory != "" {
+		category = githubv4.NewID(githubv4.ID(s.cfg.GitHub.PostsCategory))
+	}
+
+	variables := map[string]interface{}{
+		"user":       githubv4.String(s.cfg.GitHub.User),
+		"repository": githubv4.String(s.cfg.GitHub.PostsRepository),
+		"posts":      githubv4.Int(10),
+		"after":      cursor(after),
+		"category":   category,
+	}
+	if err := s.query(ctx, "posts", &query, variables); err != nil {
+		return nil, err
+	}
+
+	return &Variables{
+		Posts:      parseDiscussions(query.User.Repository.Discussions),
+		PostsAfter: nextCursor(query.User.Repository.Discussions.PageInfo),
+		FetchedAt:  time.Now(),
+	}, nil
+}
+
+func (s *Server) FetchPost(ctx context.Context, number int) (*Variables, error) {
+	var query struct {
+		RateLimited
+		User struct {
+			Login      string
+			AvatarURL  string
+			Repository struct {
+				Name       string
+				Discussion Discussion `graphql:"discussion(number: $number)"`
+			} `graphql:"repository(name: $repository)"`
+		} `graphql:"user(login: $user)"`
+	}
+	variables := map[string]interface{}{
+		"user":       githubv4.String(s.cfg.GitHub.User),
+		"repository": githubv4.String(s.cfg.GitHub.PostsRepository),
+		"number":     githubv4.Int(number),
+		"comments":   githubv4.Int(50),
+		"replies":    githubv4.Int(50),
+	}
+	if err := s.query(ctx, "post", &query, variables); err != nil {
+		// GitHub answers unknown discussion numbers with an error and a null discussion,
+		// while the surrounding repository still resolves.
+		var gqlErr *GraphQLError
+		if errors.As(err, &gqlErr) && query.User.Repository.Name != "" && query.User.Repository.Discussion.Number == 0 {
+			return nil, ErrPostNotFound
+		}
+		return nil, err
+	}
+
+	post := parseDiscussion(query.User.Repository.Discussion)
+	return &Variables{
+		User: User{
+			Name:      query.User.Login,
+			AvatarURL: template.URL(query.User.AvatarURL),
+		},
+		Post:        &post,
+		Dark:        true,
+		Description: post.Title,
+		FetchedAt:   time.Now(),
+	}, nil
+}
+
+func (s *Server) FetchComments(ctx context.Context, number int, after string) (*Post, error) {
+	var query struct {
+		RateLimited
+		User struct {
+			Repository struct {
+				Discussion struct {
+					Number   int
+					Comments DiscussionComments `graphql:"comments(after: $after, first: $comments)"`
+				} `graphql:"discussion(number: $number)"`
+			} `graphql:"repository(name: $repository)"`
+		} `graphql:"user(login: $user)"`
+	}
+	variables := map[string]interface{}{
+		"user":       githubv4.String(s.cfg.GitHub.User),
+		"repository": githubv4.String(s.cfg.GitHub.PostsRepository),
+		"number":     githubv4.Int(number),
+		"comments":   githubv4.Int(50),
+		"replies":    githubv4.Int(50),
+		"after":      cursor(after),
+	}
+	err := s.query(ctx, "comments", &query, variables)
+	var gqlErr *GraphQLError
+	if (err == nil || errors.As(err, &gqlErr)) && query.User.Repository.Discussion.Number == 0 {
+		return nil, ErrPostNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	discussion := query.User.Repository.Discussion
+	return &Post{
+		Number:        discussion.Number,
+		Comments:      parseDiscussionComments(discussion.Comments),
+		CommentsAfter: nextCursor(discussion.Comments.PageInfo),
+		CommentsCount: discussion.Comments.TotalCount,
+	}, nil
+}
+
+func (s *Server) FetchReplies(ctx context.Context, commentID string, after string) (*Comment, error) {
+	var query struct {
+		RateLimited
+		Node struct {
+			DiscussionComment struct {
+				ID         string
+				Discussion struct {
+					Repository struct {
+						NameWithOwner string
+					}
+				}
+				Replies DiscussionReplies `graphql:"replies(after: $after, first: $replies)"`
+			} `graphql:"... on DiscussionComment"`
+		} `graphql:"node(id: $comment)"`
+	}
+	variables := map[string]interface{}{
+		"comment": githubv4.ID(commentID),
+		"replies": githubv4.Int(50),
+		"after":   cursor(after),
+	}
+	err := s.query(ctx, "replies", &query, variables)
+	var gqlErr *GraphQLError
+	if (err == nil || errors.As(err, &gqlErr)) && query.Node.DiscussionComment.ID == "" {
+		return nil, ErrCommentNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	comment := query.Node.DiscussionComment
+	// the id comes from the url, so don't serve comments from anywhere else on GitHub
+	if !strings.EqualFold(comment.Discussion.Repository.NameWithOwner, s.cfg.GitHub.User+"/"+s.cfg.GitHub.PostsRepository) {
+		return nil, ErrCommentNotFound
+	}
+	return &Comment{
+		ID:           comment.ID,
+		Replies:      parseDiscussionReplies(comment.Replies),
+		RepliesAfter: nextCursor(comment.Replies.PageInfo),
+	}, nil
+}
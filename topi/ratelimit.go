@@ -0,0 +1,119 @@
+package topi
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// rateLimitStretchFactor is how much longer cached data is used while the rate limit is low.
+const rateLimitStretchFactor = 4
+
+// rateLimitRetention is how long cached data is kept around to be served while the rate limit is critical.
+// GitHub resets the rate limit every hour.
+const rateLimitRetention = time.Hour
+
+const (
+	RateLimitModeNormal    = "normal"
+	RateLimitModeLow       = "low"
+	RateLimitModeCacheOnly = "cache_only"
+)
+
+// RateLimited is embedded into GitHub queries to fetch the rate limit alongside them.
+type RateLimited struct {
+	RateLimit RateLimit
+}
+
+func (r *RateLimited) rateLimit() RateLimit {
+	return r.RateLimit
+}
+
+type RateLimit struct {
+	Limit     int
+	Remaining int
+	Cost      int
+	ResetAt   time.Time
+}
+
+// StretchFunc returns for how long data which is usually refreshed every d should be used instead.
+// ok is false when no data should be fetched as long as there is any.
+type StretchFunc func(d time.Duration) (stretched time.Duration, ok bool)
+
+// RateLimitTracker holds the latest known GitHub rate limit. It is shared between server reloads.
+type RateLimitTracker struct {
+	mu        sync.Mutex
+	rateLimit *RateLimit
+}
+
+func (t *RateLimitTracker) Load() *RateLimit {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.rateLimit
+}
+
+// Store replaces the rate limit and returns the previous one.
+func (t *RateLimitTracker) Store(rateLimit RateLimit) *RateLimit {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	previous := t.rateLimit
+	t.rateLimit = &rateLimit
+	return previous
+}
+
+// rateLimitMode returns how much data may be fetched with the remaining rate limit.
+func (s *Server) rateLimitMode(rateLimit *RateLimit) string {
+	if rateLimit == nil || time.Now().After(rateLimit.ResetAt) {
+		return RateLimitModeNormal
+	}
+	switch {
+	case rateLimit.Remaining < s.cfg.GitHub.RateLimitCritical:
+		return RateLimitModeCacheOnly
+	case rateLimit.Remaining < s.cfg.GitHub.RateLimitLow:
+		return RateLimitModeLow
+	}
+	return RateLimitModeNormal
+}
+
+// stretchGitHub is the StretchFunc of data fetched from GitHub.
+func (s *Server) stretchGitHub(d time.Duration) (time.Duration, bool) {
+	switch s.rateLimitMode(s.rateLimits.Load()) {
+	case RateLimitModeLow:
+		return d * rateLimitStretchFactor, true
+	case RateLimitModeCacheOnly:
+		return 0, false
+	}
+	return d, true
+}
+
+// observeRateLimit records the rate limit returned by a query and logs changes of the rate limit mode.
+func (s *Server) observeRateLimit(ctx context.Context, operation string, rateLimit RateLimit) {
+	if rateLimit.ResetAt.IsZero() {
+		// the query failed before GitHub evaluated it
+		return
+	}
+
+	previous := s.rateLimits.Store(rateLimit)
+	s.metrics.ObserveRateLimit(operation, rateLimit)
+	slog.DebugContext(ctx, "github rate limit",
+		slog.String("operation", operation),
+		slog.Int("cost", rateLimit.Cost),
+		slog.Int("remaining", rateLimit.Remaining),
+		slog.Int("limit", rateLimit.Limit),
+		slog.Time("reset_at", rateLimit.ResetAt),
+	)
+
+	previousMode, mode := s.rateLimitMode(previous), s.rateLimitMode(&rateLimit)
+	if mode == previousMode {
+		return
+	}
+	attrs := []any{slog.String("mode", mode), slog.Int("remaining", rateLimit.Remaining), slog.Time("reset_at", rateLimit.ResetAt)}
+	switch mode {
+	case RateLimitModeLow:
+		slog.WarnContext(ctx, "github rate limit is running low, keeping cached data longer", attrs...)
+	case RateLimitModeCacheOnly:
+		slog.WarnContext(ctx, "github rate limit is almost used up, serving cached data only", attrs...)
+	default:
+		slog.InfoContext(ctx, "github rate limit recovered", attrs...)
+	}
+}
@@ -0,0 +1,239 @@
+package topi
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// loadAttempts is how often Load fetches the data when the store is reset while fetching.
+const loadAttempts = 3
+
+var ErrNoSnapshot = errors.New("no data available, the settings changed while fetching it")
+
+// refreshTimeout bounds a single background refresh, so a hanging upstream can't stall the refresher.
+const refreshTimeout = 30 * time.Second
+
+// Snapshot is the last successfully fetched and highlighted site data.
+// Vars must be treated as read-only since it is shared between requests.
+type Snapshot struct {
+	Vars      *Variables
+	FetchedAt time.Time
+	Err       error
+	ErrAt     time.Time
+}
+
+// Stale reports whether the latest refresh failed and the snapshot is outdated.
+func (s Snapshot) Stale() bool {
+	return s.Err != nil && s.ErrAt.After(s.FetchedAt)
+}
+
+// NewSnapshotStore creates a SnapshotStore for data of identity which is seeded from and persisted to disk if it is not nil.
+func NewSnapshotStore(disk *DiskStore, identity string) *SnapshotStore {
+	s := &SnapshotStore{disk: disk, identity: identity}
+	if disk == nil {
+		return s
+	}
+
+	snapshot, err := disk.LoadSnapshot(identity)
+	if err != nil {
+		slog.Error("failed to load persisted snapshot", slog.Any("error", err))
+		return s
+	}
+	if snapshot != nil {
+		slog.Info("loaded persisted snapshot", slog.Time("fetched_at", snapshot.FetchedAt))
+		s.snapshot.Store(snapshot)
+	}
+	return s
+}
+
+// SnapshotStore holds the current Snapshot. It is shared between server reloads so no data is lost.
+type SnapshotStore struct {
+	snapshot atomic.Pointer[Snapshot]
+	disk     *DiskStore
+
+	// mu serializes Store and Reset, so no outdated snapshot is stored after a reset
+	mu         sync.Mutex
+	generation uint64
+	identity   string
+	persisted  *Snapshot
+}
+
+func (s *SnapshotStore) Load() *Snapshot {
+	return s.snapshot.Load()
+}
+
+// Generation identifies the data held by the store. It changes with every Reset.
+func (s *SnapshotStore) Generation() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.generation
+}
+
+// Store replaces the current snapshot. Fresh snapshots are also persisted to disk.
+// The snapshot is dropped if the store was reset since generation was obtained, since it was fetched for outdated settings.
+func (s *SnapshotStore) Store(generation uint64, snapshot *Snapshot) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if generation != s.generation {
+		return
+	}
+
+	s.snapshot.Store(snapshot)
+	if s.disk == nil || snapshot.Vars == nil || snapshot.Stale() {
+		return
+	}
+	// only write unchanged data every persistInterval
+	if persisted := s.persisted; persisted != nil && snapshot.FetchedAt.Sub(persisted.FetchedAt) < persistInterval && sameContent(persisted.Vars, snapshot.Vars) {
+		return
+	}
+	if err := s.disk.SaveSnapshot(s.identity, *snapshot); err != nil {
+		slog.Error("failed to persist snapshot", slog.Any("error", err))
+		return
+	}
+	s.persisted = snapshot
+}
+
+// sameContent reports whether a and b hold the same data, no matter when it was fetched.
+func sameContent(a *Variables, b *Variables) bool {
+	aVars, bVars := *a, *b
+	aVars.FetchedAt, bVars.FetchedAt = time.Time{}, time.Time{}
+	return reflect.DeepEqual(aVars, bVars)
+}
+
+// Reset drops the current snapshot, also from disk, and holds data of identity from now on.
+func (s *SnapshotStore) Reset(identity string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.generation++
+	s.identity = identity
+	s.persisted = nil
+	s.snapshot.Store(nil)
+	if s.disk == nil {
+		return
+	}
+	if err := s.disk.DeleteSnapshot(); err != nil {
+		slog.Error("failed to delete persisted snapshot", slog.Any("error", err))
+	}
+}
+
+type FetchSnapshotFunc func(ctx context.Context) (*Variables, error)
+
+func NewRefresher(interval time.Duration, store *SnapshotStore, fetch FetchSnapshotFunc, stretch StretchFunc) *Refresher {
+	return &Refresher{
+		interval: interval,
+		store:    store,
+		fetch:    fetch,
+		stretch:  stretch,
+		done:     make(chan struct{}),
+	}
+}
+
+// Refresher periodically refreshes the site data in the background.
+// When a refresh fails the previous snapshot is kept and marked as stale.
+type Refresher struct {
+	interval time.Duration
+	store    *SnapshotStore
+	fetch    FetchSnapshotFunc
+	stretch  StretchFunc
+	mu       sync.Mutex
+	done     chan struct{}
+	once     sync.Once
+}
+
+// Run refreshes the data every interval until Close is called.
+func (r *Refresher) Run() {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		if r.due() {
+			ctx, cancel := context.WithTimeout(context.Background(), refreshTimeout)
+			_ = r.Refresh(ctx)
+			cancel()
+		}
+
+		select {
+		case <-r.done:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// due reports whether the snapshot should be refreshed. While the rate limit is low this happens less often.
+func (r *Refresher) due() bool {
+	snapshot := r.store.Load()
+	if r.stretch == nil || snapshot == nil || snapshot.Vars == nil {
+		return true
+	}
+	interval, ok := r.stretch(r.interval)
+	if !ok {
+		return false
+	}
+	// ticks don't line up exactly with the time of the last fetch
+	return time.Since(snapshot.FetchedAt) >= interval-r.interval/2
+}
+
+// Refresh fetches the data and stores it as the new snapshot.
+func (r *Refresher) Refresh(ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.refresh(ctx)
+}
+
+func (r *Refresher) refresh(ctx context.Context) error {
+	generation := r.store.Generation()
+	vars, err := r.fetch(ctx)
+	now := time.Now()
+	if err != nil {
+		slog.WarnContext(ctx, "failed to refresh data, keeping the previous snapshot", slog.Any("error", err))
+		snapshot := Snapshot{}
+		if current := r.store.Load(); current != nil {
+			snapshot = *current
+		}
+		snapshot.Err = err
+		snapshot.ErrAt = now
+		r.store.Store(generation, &snapshot)
+		return err
+	}
+
+	r.store.Store(generation, &Snapshot{
+		Vars:      vars,
+		FetchedAt: now,
+	})
+	return nil
+}
+
+// Load returns the current snapshot. If there is no data yet, it is fetched synchronously.
+func (r *Refresher) Load(ctx context.Context) (*Snapshot, error) {
+	if snapshot := r.store.Load(); snapshot != nil && snapshot.Vars != nil {
+		return snapshot, nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	// another request might have fetched the data while we were waiting
+	if snapshot := r.store.Load(); snapshot != nil && snapshot.Vars != nil {
+		return snapshot, nil
+	}
+	for attempt := 0; attempt < loadAttempts; attempt++ {
+		if err := r.refresh(ctx); err != nil {
+			return nil, err
+		}
+		if snapshot := r.store.Load(); snapshot != nil && snapshot.Vars != nil {
+			return snapshot, nil
+		}
+		// the store was reset while fetching, so the data was dropped
+	}
+	return nil, ErrNoSnapshot
+}
+
+func (r *Refresher) Close() {
+	r.once.Do(func() {
+		close(r.done)
+	})
+}
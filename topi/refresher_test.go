@@ -0,0 +1,66 @@
+package topi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestRefresherLoadResetWhileFetching(t *testing.T) {
+	tests := []struct {
+		name     string
+		resets   int
+		wantUser string
+		wantErr  error
+	}{
+		{name: "no reset", resets: 0, wantUser: "fetch 1"},
+		{name: "reset once", resets: 1, wantUser: "fetch 2"},
+		{name: "reset every time", resets: loadAttempts, wantErr: ErrNoSnapshot},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := NewSnapshotStore(nil, "user")
+			var fetches int
+			fetch := func(ctx context.Context) (*Variables, error) {
+				fetches++
+				if fetches <= tt.resets {
+					// a reload changing the user happens while the data is fetched
+					store.Reset("other")
+				}
+				return &Variables{User: User{Name: fmt.Sprintf("fetch %d", fetches)}}, nil
+			}
+
+			snapshot, err := NewRefresher(time.Minute, store, fetch, nil).Load(context.Background())
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) || snapshot != nil {
+					t.Fatalf("expected error %v and no snapshot, got %v and %v", tt.wantErr, err, snapshot)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if snapshot == nil || snapshot.Vars == nil || snapshot.Vars.User.Name != tt.wantUser {
+				t.Fatalf("expected snapshot of %q, got %+v", tt.wantUser, snapshot)
+			}
+		})
+	}
+}
+
+func TestSnapshotStoreDropsOutdatedSnapshots(t *testing.T) {
+	store := NewSnapshotStore(nil, "user")
+	generation := store.Generation()
+	store.Reset("other")
+	store.Store(generation, &Snapshot{Vars: &Variables{}, FetchedAt: time.Now()})
+	if snapshot := store.Load(); snapshot != nil {
+		t.Fatalf("expected the outdated snapshot to be dropped, got %+v", snapshot)
+	}
+
+	store.Store(store.Generation(), &Snapshot{Vars: &Variables{}, FetchedAt: time.Now()})
+	if snapshot := store.Load(); snapshot == nil {
+		t.Fatal("expected the current snapshot to be stored")
+	}
+}
@@ -0,0 +1,156 @@
+package topi
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// retryStatusCodes are the status codes of responses which are worth retrying.
+var retryStatusCodes = map[int]bool{
+	http.StatusTooManyRequests:    true,
+	http.StatusBadGateway:         true,
+	http.StatusServiceUnavailable: true,
+	http.StatusGatewayTimeout:     true,
+}
+
+// NewRetryTransport wraps base so that idempotent requests failing with a transient error are retried
+// with jittered exponential backoff.
+func NewRetryTransport(base http.RoundTripper, cfg RetryConfig) http.RoundTripper {
+	return &retryTransport{
+		base: base,
+		cfg:  cfg,
+	}
+}
+
+type retryTransport struct {
+	base http.RoundTripper
+	cfg  RetryConfig
+}
+
+func (t *retryTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	ctx := r.Context()
+	canRetry := isIdempotent(r) && (r.Body == nil || r.Body == http.NoBody || r.GetBody != nil)
+
+	for attempt := 1; ; attempt++ {
+		rs, err := t.base.RoundTrip(r)
+		if !canRetry || attempt >= t.cfg.Attempts || ctx.Err() != nil || (err == nil && !retryStatusCodes[rs.StatusCode]) {
+			return rs, err
+		}
+
+		wait := t.backoff(attempt)
+		if rs != nil {
+			if retryAfter, ok := parseRetryAfter(rs.Header.Get("Retry-After")); ok {
+				wait = retryAfter
+			}
+		}
+		// don't wait for a retry which can't finish in time anyway
+		if deadline, ok := ctx.Deadline(); (ok && time.Now().Add(wait).After(deadline)) || wait > t.cfg.MaxBackoff {
+			return rs, err
+		}
+
+		attrs := []any{slog.String("method", r.Method), slog.String("host", r.URL.Host), slog.Int("attempt", attempt), slog.Duration("wait", wait)}
+		if err != nil {
+			attrs = append(attrs, slog.Any("error", err))
+		} else {
+			attrs = append(attrs, slog.Int("status", rs.StatusCode))
+			_, _ = io.Copy(io.Discard, rs.Body)
+			_ = rs.Body.Close()
+		}
+		slog.WarnContext(ctx, "upstream request failed, retrying", attrs...)
+
+		if err = sleep(ctx, wait); err != nil {
+			return nil, err
+		}
+
+		if r, err = rewind(r); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// backoff returns a random duration up to the exponential backoff of attempt, capped at MaxBackoff.
+func (t *retryTransport) backoff(attempt int) time.Duration {
+	backoff := t.cfg.MaxBackoff
+	if shift := attempt - 1; shift < 32 {
+		backoff = min(t.cfg.InitialBackoff<<shift, t.cfg.MaxBackoff)
+	}
+	return time.Duration(rand.Int63n(int64(backoff) + 1))
+}
+
+// isIdempotent reports whether r can be retried, following the rules of http.Transport.
+// Requests with other methods can be marked as idempotent by setting an Idempotency-Key or X-Idempotency-Key header.
+func isIdempotent(r *http.Request) bool {
+	switch r.Method {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	_, ok := r.Header["Idempotency-Key"]
+	if !ok {
+		_, ok = r.Header["X-Idempotency-Key"]
+	}
+	return ok
+}
+
+// rewind returns a copy of r with a fresh body, so it can be sent again.
+func rewind(r *http.Request) (*http.Request, error) {
+	if r.GetBody == nil {
+		return r, nil
+	}
+	body, err := r.GetBody()
+	if err != nil {
+		return nil, err
+	}
+	r = r.Clone(r.Context())
+	r.Body = body
+	return r, nil
+}
+
+// parseRetryAfter parses the Retry-After header, which is either a number of seconds or an HTTP date.
+func parseRetryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		return max(time.Until(t), 0), true
+	}
+	return 0, false
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// MarkIdempotent wraps base so that all requests are considered idempotent and retried on failure.
+// It is meant for clients which only send read-only requests with unsafe methods, like GraphQL queries.
+// The marker header is never sent, since it has no value.
+func MarkIdempotent(base http.RoundTripper) http.RoundTripper {
+	return roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		if _, ok := r.Header["Idempotency-Key"]; ok {
+			return base.RoundTrip(r)
+		}
+		r = r.Clone(r.Context())
+		r.Header["X-Idempotency-Key"] = nil
+		return base.RoundTrip(r)
+	})
+}
+
+type roundTripperFunc func(r *http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
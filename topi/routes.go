@@ -7,14 +7,14 @@ import (
 	"io"
 	"log/slog"
 	"net/http"
-	"strings"
+	"strconv"
 
 	"github.com/alecthomas/chroma/v2"
 	chtml "github.com/alecthomas/chroma/v2/formatters/html"
 	"github.com/alecthomas/chroma/v2/styles"
+	"github.com/andybalholm/brotli"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
-	"github.com/go-chi/stampede"
 	"github.com/topi314/slog-chi"
 )
 
@@ -28,7 +28,9 @@ func (s *Server) Routes() http.Handler {
 	r.Use(middleware.CleanPath)
 	r.Use(middleware.RealIP)
 	r.Use(middleware.RequestID)
-	r.Use(middleware.Compress(5))
+	r.Use(tracing)
+	r.Use(s.metrics.Middleware)
+	r.Use(compress)
 	r.Use(slogchi.NewWithConfig(slog.Default(), slogchi.Config{
 		DefaultLevel:     slog.LevelInfo,
 		ClientErrorLevel: slog.LevelDebug,
@@ -36,78 +38,143 @@ func (s *Server) Routes() http.Handler {
 		WithRequestID:    true,
 		Filters: []slogchi.Filter{
 			slogchi.IgnorePathPrefix("/assets"),
+			slogchi.IgnorePath("/metrics", "/healthz", "/readyz"),
 		},
 	}))
-	r.Use(cacheControl)
+	r.Use(s.cacheControl)
 	r.Use(middleware.Recoverer)
 	r.Use(middleware.Heartbeat("/ping"))
 
-	r.Mount("/assets", http.FileServer(s.assets))
+	r.Get("/healthz", s.healthz)
+	r.Get("/readyz", s.readyz)
+
+	r.Mount("/assets", s.assetManifest.Handler(http.FileServer(s.assets)))
 	r.Get("/dark.css", s.theme(StyleDark))
 	r.Get("/light.css", s.theme(StyleLight))
-	r.Handle("/robots.txt", s.file("/assets/robots.txt"))
+	r.Get("/robots.txt", s.robots)
 
-	stampedeMiddleware := func(handler http.Handler) http.Handler { return handler }
-	lastFMStampedeMiddleware := func(handler http.Handler) http.Handler { return handler }
-	if s.cfg.Cache != nil && s.cfg.Cache.Size > 0 && s.cfg.Cache.TTL > 0 {
-		stampedeMiddleware = stampede.HandlerWithKey(s.cfg.Cache.Size, s.cfg.Cache.TTL, cacheKeyFunc)
-	}
-	if s.cfg.LastFM.Size > 0 && s.cfg.LastFM.TTL > 0 {
-		lastFMStampedeMiddleware = stampede.HandlerWithKey(s.cfg.LastFM.Size, s.cfg.LastFM.TTL, cacheKeyFunc)
+	if s.cfg.AdminListenAddr == "" {
+		r.Handle("/metrics", s.metrics.Handler())
+		r.Get("/circuit-breakers", s.circuitBreakers)
 	}
 
 	r.Group(func(r chi.Router) {
+		r.Use(conditional)
 		r.Route("/api", func(r chi.Router) {
-			r.Route("/repositories", func(r chi.Router) {
-				r.Use(stampedeMiddleware)
-				r.Get("/", s.repositories)
-			})
-			r.Route("/lastfm", func(r chi.Router) {
-				r.Use(lastFMStampedeMiddleware)
-				r.Get("/", s.lastfm)
-			})
-		})
-		r.Route("/", func(r chi.Router) {
-			r.Use(stampedeMiddleware)
-			r.Get("/", s.index)
-			r.Head("/", s.index)
+			r.Get("/repositories", s.repositories)
+			r.Get("/posts", s.posts)
+			r.Get("/posts/{number}/comments", s.comments)
+			r.Get("/comments/{commentID}/replies", s.replies)
+			r.Get("/lastfm", s.lastfm)
 		})
+		r.Get("/", s.index)
+		r.Head("/", s.index)
+		r.Get("/posts/{number}", s.post)
+		r.Get("/feed.atom", s.feed(FeedFormatAtom))
+		r.Get("/feed.rss", s.feed(FeedFormatRSS))
+		r.Get("/feed.json", s.feed(FeedFormatJSON))
+		r.Get("/sitemap.xml", s.sitemap)
 	})
 	r.NotFound(s.redirectRoot)
 	return r
 }
 
-func cacheKeyFunc(r *http.Request) uint64 {
-	theme := "dark"
-	cookie, _ := r.Cookie("theme")
-	if cookie != nil {
-		theme = cookie.Value
-	}
-	return stampede.BytesToHash([]byte(theme), []byte(strings.ToLower(r.URL.Path)), []byte(r.URL.RawQuery))
+// AdminRoutes returns the handler of the optional admin listener.
+func (s *Server) AdminRoutes() http.Handler {
+	r := chi.NewRouter()
+	r.Use(middleware.Recoverer)
+	r.Handle("/metrics", s.metrics.Handler())
+	r.Get("/circuit-breakers", s.circuitBreakers)
+	return r
 }
 
 func (s *Server) repositories(w http.ResponseWriter, r *http.Request) {
 	after := r.URL.Query().Get("after")
 	ctx := r.Context()
-	vars, err := s.FetchRepositories(ctx, after)
+	vars, err := s.cachedRepositories(ctx, after)
 	if err != nil {
 		slog.ErrorContext(ctx, "failed to fetch repositories", slog.Any("error", err))
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
-	if err = s.tmpl(w, "projects.gohtml", vars); err != nil {
+	setLastModified(w, lastModified(vars))
+	if err = s.render(r.Context(), w, "projects.gohtml", vars); err != nil {
 		slog.ErrorContext(ctx, "failed to render projects template", slog.Any("error", err))
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 }
 
+func (s *Server) posts(w http.ResponseWriter, r *http.Request) {
+	after := r.URL.Query().Get("after")
+	ctx := r.Context()
+	vars, err := s.cachedPosts(ctx, after)
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to fetch posts", slog.Any("error", err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	setLastModified(w, lastModified(vars))
+	if err = s.render(r.Context(), w, "posts.gohtml", vars); err != nil {
+		slog.ErrorContext(ctx, "failed to render posts template", slog.Any("error", err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+}
+
+func (s *Server) comments(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	number, err := strconv.Atoi(chi.URLParam(r, "number"))
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	post, err := s.cachedComments(ctx, number, r.URL.Query().Get("after"))
+	if errors.Is(err, ErrPostNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to fetch comments", slog.Any("error", err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if err = s.render(r.Context(), w, "comments.gohtml", post); err != nil {
+		slog.ErrorContext(ctx, "failed to render comments template", slog.Any("error", err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+}
+
+func (s *Server) replies(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	comment, err := s.cachedReplies(ctx, chi.URLParam(r, "commentID"), r.URL.Query().Get("after"))
+	if errors.Is(err, ErrCommentNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to fetch replies", slog.Any("error", err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if err = s.render(r.Context(), w, "replies.gohtml", comment); err != nil {
+		slog.ErrorContext(ctx, "failed to render replies template", slog.Any("error", err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+}
+
 func (s *Server) lastfm(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
-	vars := s.FetchLastFM(ctx)
+	vars := s.cachedLastFM(ctx)
 
-	if err := s.tmpl(w, "lastfm.gohtml", vars); err != nil {
+	if err := s.render(r.Context(), w, "lastfm.gohtml", vars); err != nil {
 		slog.ErrorContext(ctx, "failed to render lastfm template", slog.Any("error", err))
 		w.WriteHeader(http.StatusInternalServerError)
 		return
@@ -115,9 +182,9 @@ func (s *Server) lastfm(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *Server) index(w http.ResponseWriter, r *http.Request) {
-	vars, err := s.FetchData(r.Context())
+	vars, err := s.SiteData(r.Context())
 	if err != nil {
-		s.error(w, r, fmt.Errorf("failed to fetch data: %w", err), http.StatusInternalServerError)
+		s.error(w, r, err, http.StatusInternalServerError)
 		return
 	}
 
@@ -125,12 +192,39 @@ func (s *Server) index(w http.ResponseWriter, r *http.Request) {
 		vars.Dark = themeCookie.Value == "dark"
 	}
 
-	if err = s.HighlightData(vars); err != nil {
-		s.error(w, r, fmt.Errorf("failed to highlight data: %w", err), http.StatusInternalServerError)
+	w.Header().Add("Vary", "Cookie")
+	setLastModified(w, lastModified(vars))
+	if err = s.render(r.Context(), w, "index.gohtml", vars); err != nil {
+		slog.ErrorContext(r.Context(), "failed to execute template", slog.Any("err", err))
+	}
+}
+
+func (s *Server) post(w http.ResponseWriter, r *http.Request) {
+	number, err := strconv.Atoi(chi.URLParam(r, "number"))
+	if err != nil || s.cfg.GitHub.PostsRepository == "" {
+		s.error(w, r, ErrPostNotFound, http.StatusNotFound)
+		return
+	}
+
+	post, err := s.cachedPost(r.Context(), number)
+	if errors.Is(err, ErrPostNotFound) {
+		s.error(w, r, err, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		s.error(w, r, fmt.Errorf("failed to fetch post: %w", err), http.StatusInternalServerError)
 		return
 	}
 
-	if err = s.tmpl(w, "index.gohtml", vars); err != nil {
+	// the cached data is shared between requests, so apply the theme to a copy
+	vars := *post
+	if themeCookie, _ := r.Cookie("theme"); themeCookie != nil {
+		vars.Dark = themeCookie.Value == "dark"
+	}
+
+	w.Header().Add("Vary", "Cookie")
+	setLastModified(w, lastModified(&vars))
+	if err = s.render(r.Context(), w, "post.gohtml", &vars); err != nil {
 		slog.ErrorContext(r.Context(), "failed to execute template", slog.Any("err", err))
 	}
 }
@@ -154,6 +248,9 @@ func (s *Server) redirectRoot(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *Server) error(w http.ResponseWriter, r *http.Request, err error, status int) {
+	if errors.Is(err, ErrCircuitOpen) || errors.Is(err, ErrNoSnapshot) {
+		status = http.StatusServiceUnavailable
+	}
 	if status == http.StatusInternalServerError {
 		slog.ErrorContext(r.Context(), "internal server error", slog.Any("error", err))
 	}
@@ -165,31 +262,62 @@ func (s *Server) error(w http.ResponseWriter, r *http.Request, err error, status
 		"RequestID": middleware.GetReqID(r.Context()),
 		"Path":      r.URL.Path,
 	}
-	if tmplErr := s.tmpl(w, "error.gohtml", vars); tmplErr != nil && !errors.Is(tmplErr, http.ErrHandlerTimeout) {
+	if tmplErr := s.render(r.Context(), w, "error.gohtml", vars); tmplErr != nil && !errors.Is(tmplErr, http.ErrHandlerTimeout) {
 		slog.ErrorContext(r.Context(), "failed to render error template", slog.Any("error", tmplErr))
 	}
 }
 
-func (s *Server) file(path string) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		file, err := s.assets.Open(path)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
+// cacheControl sets the Cache-Control header from the policy configured for the matched route.
+// Error responses are never cached.
+func (s *Server) cacheControl(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(&cacheControlResponseWriter{
+			ResponseWriter: w,
+			r:              r,
+			policies:       s.cfg.CacheControl,
+		}, r)
+	})
+}
+
+// cacheControlResponseWriter sets the Cache-Control header once the response is written,
+// since the route pattern is only known after routing.
+type cacheControlResponseWriter struct {
+	http.ResponseWriter
+	r           *http.Request
+	policies    CacheControlConfig
+	wroteHeader bool
+}
+
+func (w *cacheControlResponseWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		if w.Header().Get("Cache-Control") == "" {
+			var policy CacheControlPolicy
+			if status < http.StatusBadRequest {
+				policy = w.policies[routePattern(w.r)]
+			}
+			w.Header().Set("Cache-Control", policy.String())
 		}
-		defer file.Close()
-		_, _ = io.Copy(w, file)
 	}
+	w.ResponseWriter.WriteHeader(status)
 }
 
-func cacheControl(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if strings.HasPrefix(r.URL.Path, "/assets/") {
-			w.Header().Set("Cache-Control", "public, max-age=86400")
-			next.ServeHTTP(w, r)
-			return
-		}
-		w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
-		next.ServeHTTP(w, r)
+func (w *cacheControlResponseWriter) Write(p []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *cacheControlResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// compress compresses dynamic responses with brotli or gzip. Precompressed assets are passed through as is.
+func compress(next http.Handler) http.Handler {
+	compressor := middleware.NewCompressor(5)
+	compressor.SetEncoder("br", func(w io.Writer, level int) io.Writer {
+		return brotli.NewWriterLevel(w, level)
 	})
+	return compressor.Handler(next)
 }
@@ -1,62 +1,297 @@
 package topi
 
 import (
+	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
 	"os"
+	"reflect"
 	"runtime"
+	"sync/atomic"
 	"time"
 
 	"github.com/shurcooL/githubv4"
+	"github.com/topi314/topi.wtf/lastfm"
 	"github.com/yuin/goldmark"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 type ExecuteTemplateFunc func(wr io.Writer, name string, data any) error
 
-func NewServer(version string, cfg Config, httpClient *http.Client, githubClient *githubv4.Client, md goldmark.Markdown, assets http.FileSystem, tmpl ExecuteTemplateFunc) *Server {
+func NewServer(version string, cfg Config, httpClient *http.Client, githubClient *githubv4.Client, md goldmark.Markdown, assets http.FileSystem, assetManifest *AssetManifest, tmpl ExecuteTemplateFunc, disk *DiskStore) *Server {
 	s := &Server{
-		version:      version,
-		cfg:          cfg,
-		httpClient:   httpClient,
-		githubClient: githubClient,
-		md:           md,
-		assets:       assets,
-		tmpl:         tmpl,
+		version:       version,
+		cfg:           cfg,
+		httpClient:    httpClient,
+		githubClient:  githubClient,
+		md:            md,
+		assets:        assets,
+		assetManifest: assetManifest,
+		tmpl:          tmpl,
+		handler:       &swapHandler{},
+		metrics:       NewMetrics(),
+		health:        NewHealth(),
+		disk:          disk,
+		snapshots:     NewSnapshotStore(disk, cfg.GitHub.Identity()),
+		rateLimits:    &RateLimitTracker{},
+		tokenChecker:  &tokenChecker{},
 	}
+	s.lastFMClient = lastfm.New(httpClient, "", cfg.LastFM.APIKey)
+	s.breakers = map[string]*CircuitBreaker{
+		UpstreamGitHub: NewCircuitBreaker(UpstreamGitHub, cfg.CircuitBreaker, s.metrics),
+		UpstreamLastFM: NewCircuitBreaker(UpstreamLastFM, cfg.CircuitBreaker, s.metrics),
+	}
+	s.cache, s.lastFMCache, s.sitemapCache = s.newDataCaches()
+	if cfg.GitHub.RefreshInterval > 0 {
+		s.refresher = NewRefresher(cfg.GitHub.RefreshInterval, s.snapshots, s.fetchSnapshot, s.stretchGitHub)
+	}
+	s.handler.Swap(s.Routes())
 
 	s.server = &http.Server{
-		Addr:    cfg.ListenAddr,
-		Handler: s.Routes(),
+		Addr:              cfg.ListenAddr,
+		Handler:           s.handler,
+		ReadTimeout:       cfg.Server.ReadTimeout,
+		ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+		WriteTimeout:      cfg.Server.WriteTimeout,
+		IdleTimeout:       cfg.Server.IdleTimeout,
+	}
+
+	if cfg.AdminListenAddr != "" {
+		s.adminServer = &http.Server{
+			Addr:              cfg.AdminListenAddr,
+			Handler:           s.AdminRoutes(),
+			ReadTimeout:       cfg.Server.ReadTimeout,
+			ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+			WriteTimeout:      cfg.Server.WriteTimeout,
+			IdleTimeout:       cfg.Server.IdleTimeout,
+		}
+	}
+
+	if cfg.TLS != nil {
+		s.certs = newCertReloader(cfg.TLS.Cert, cfg.TLS.Key)
+		s.server.TLSConfig = &tls.Config{
+			MinVersion:     tls.VersionTLS12,
+			GetCertificate: s.certs.GetCertificate,
+		}
+
+		if cfg.TLS.RedirectAddr != "" {
+			s.redirectServer = &http.Server{
+				Addr:              cfg.TLS.RedirectAddr,
+				Handler:           redirectHTTPS(cfg.ListenAddr),
+				ReadTimeout:       cfg.Server.ReadTimeout,
+				ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+				WriteTimeout:      cfg.Server.WriteTimeout,
+				IdleTimeout:       cfg.Server.IdleTimeout,
+			}
+		}
 	}
 
 	return s
 }
 
 type Server struct {
-	version      string
-	cfg          Config
-	httpClient   *http.Client
-	githubClient *githubv4.Client
-	server       *http.Server
-	md           goldmark.Markdown
-	assets       http.FileSystem
-	tmpl         ExecuteTemplateFunc
+	version       string
+	cfg           Config
+	httpClient    *http.Client
+	lastFMClient  *lastfm.Client
+	githubClient  *githubv4.Client
+	server        *http.Server
+	md            goldmark.Markdown
+	assets        http.FileSystem
+	assetManifest *AssetManifest
+	tmpl          ExecuteTemplateFunc
+	handler       *swapHandler
+	metrics       *Metrics
+	health        *Health
+	disk          *DiskStore
+	snapshots     *SnapshotStore
+	refresher     *Refresher
+	rateLimits    *RateLimitTracker
+	tokenChecker  *tokenChecker
+	breakers      map[string]*CircuitBreaker
+	cache         *DataCache
+	lastFMCache   *DataCache
+	sitemapCache  *DataCache
+
+	adminServer    *http.Server
+	certs          *certReloader
+	redirectServer *http.Server
+}
+
+// Reload returns a new Server using cfg and githubClient which takes over serving requests from s.
+// Requests already in flight are finished by s, so no connections are dropped.
+func (s *Server) Reload(cfg Config, githubClient *githubv4.Client) *Server {
+	if cfg.ListenAddr != s.cfg.ListenAddr {
+		slog.Warn("listen_addr can't be changed without a restart", slog.String("listen_addr", s.cfg.ListenAddr))
+		cfg.ListenAddr = s.cfg.ListenAddr
+	}
+	if cfg.AdminListenAddr != s.cfg.AdminListenAddr {
+		slog.Warn("admin_listen_addr can't be changed without a restart", slog.String("admin_listen_addr", s.cfg.AdminListenAddr))
+		cfg.AdminListenAddr = s.cfg.AdminListenAddr
+	}
+	if cfg.Server.ReadTimeout != s.cfg.Server.ReadTimeout || cfg.Server.ReadHeaderTimeout != s.cfg.Server.ReadHeaderTimeout ||
+		cfg.Server.WriteTimeout != s.cfg.Server.WriteTimeout || cfg.Server.IdleTimeout != s.cfg.Server.IdleTimeout {
+		slog.Warn("server timeouts other than shutdown_timeout can't be changed without a restart")
+	}
+
+	if cfg.DataDir != s.cfg.DataDir {
+		slog.Warn("data_dir can't be changed without a restart", slog.String("data_dir", s.cfg.DataDir))
+		cfg.DataDir = s.cfg.DataDir
+	}
+
+	if !reflect.DeepEqual(cfg.TLS, s.cfg.TLS) {
+		slog.Warn("tls can't be changed without a restart, certificates are reloaded automatically")
+		cfg.TLS = s.cfg.TLS
+	}
+	if cfg.Retry != s.cfg.Retry {
+		slog.Warn("retry can't be changed without a restart")
+		cfg.Retry = s.cfg.Retry
+	}
+	if cfg.CircuitBreaker != s.cfg.CircuitBreaker {
+		slog.Warn("circuit_breaker can't be changed without a restart")
+		cfg.CircuitBreaker = s.cfg.CircuitBreaker
+	}
+	if !reflect.DeepEqual(cfg.Otel, s.cfg.Otel) {
+		slog.Warn("otel can't be changed without a restart")
+		cfg.Otel = s.cfg.Otel
+	}
+
+	next := *s
+	next.cfg = cfg
+	next.githubClient = githubClient
+	next.lastFMClient = lastfm.New(next.httpClient, "", cfg.LastFM.APIKey)
+	// the user or repositories might have changed, so start with empty caches
+	next.cache, next.lastFMCache, next.sitemapCache = next.newDataCaches()
+	if cfg.GitHub.Identity() != s.cfg.GitHub.Identity() {
+		// the snapshot holds data of the previous user, so fetch the new data before serving anything
+		next.snapshots.Reset(cfg.GitHub.Identity())
+	}
+	if cfg.LastFM.Username != s.cfg.LastFM.Username && next.disk != nil {
+		if err := next.disk.DeleteLastFM(); err != nil {
+			slog.Error("failed to delete persisted lastfm state", slog.Any("error", err))
+		}
+	}
+	// the token might have changed, so check it again on the next readiness probe
+	next.health.Reset(ComponentGitHubToken)
+	next.tokenChecker = &tokenChecker{}
+	next.refresher = nil
+	if cfg.GitHub.RefreshInterval > 0 {
+		next.refresher = NewRefresher(cfg.GitHub.RefreshInterval, next.snapshots, next.fetchSnapshot, next.stretchGitHub)
+	}
+
+	// next must be complete before it is published, since requests start using it right away
+	s.handler.Swap(next.Routes())
+	if s.refresher != nil {
+		s.refresher.Close()
+	}
+	if next.refresher != nil {
+		go next.refresher.Run()
+	}
+
+	return &next
+}
+
+// swapHandler is a http.Handler which forwards to a handler that can be replaced at runtime.
+type swapHandler struct {
+	handler atomic.Pointer[http.Handler]
+}
+
+func (h *swapHandler) Swap(handler http.Handler) {
+	h.handler.Store(&handler)
+}
+
+func (h *swapHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	(*h.handler.Load()).ServeHTTP(w, r)
 }
 
 func (s *Server) Start() {
-	if err := s.server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+	if s.refresher != nil {
+		go s.refresher.Run()
+	}
+	if s.adminServer != nil {
+		go listen(s.adminServer.ListenAndServe)
+	}
+
+	if s.certs == nil {
+		listen(s.server.ListenAndServe)
+		return
+	}
+
+	if err := s.certs.Load(); err != nil {
+		slog.Error("Error while loading tls certificate", slog.Any("err", err))
+		os.Exit(-1)
+	}
+	go s.certs.Watch()
+
+	if s.redirectServer != nil {
+		go listen(s.redirectServer.ListenAndServe)
+	}
+	listen(func() error {
+		return s.server.ListenAndServeTLS("", "")
+	})
+}
+
+func listen(listenAndServe func() error) {
+	if err := listenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
 		slog.Error("Error while listening", slog.Any("err", err))
 		os.Exit(-1)
 	}
 }
 
+// Close gracefully shuts down the server, waiting up to the configured shutdown timeout for in-flight requests to finish.
 func (s *Server) Close() {
-	if err := s.server.Close(); err != nil {
-		slog.Error("Error while closing server", slog.Any("err", err))
+	ctx := context.Background()
+	if s.cfg.Server.ShutdownTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.cfg.Server.ShutdownTimeout)
+		defer cancel()
+	}
+
+	if s.refresher != nil {
+		s.refresher.Close()
+	}
+	if s.certs != nil {
+		s.certs.Close()
 	}
+	if s.redirectServer != nil {
+		shutdown(ctx, s.redirectServer)
+	}
+	if s.adminServer != nil {
+		shutdown(ctx, s.adminServer)
+	}
+	shutdown(ctx, s.server)
+}
+
+func shutdown(ctx context.Context, server *http.Server) {
+	if err := server.Shutdown(ctx); err != nil {
+		slog.Error("Error while shutting down server, closing remaining connections", slog.Any("err", err))
+		if err = server.Close(); err != nil {
+			slog.Error("Error while closing server", slog.Any("err", err))
+		}
+	}
+}
+
+func (s *Server) newDataCaches() (*DataCache, *DataCache, *DataCache) {
+	var cache CacheConfig
+	if s.cfg.Cache != nil {
+		cache = *s.cfg.Cache
+	}
+	return NewDataCache(CacheGitHub, cache.Size, cache.TTL, s.metrics, s.stretchGitHub),
+		NewDataCache(CacheLastFM, s.cfg.LastFM.Size, s.cfg.LastFM.TTL, s.metrics, nil),
+		NewDataCache(CacheSitemap, 1, sitemapTTL, s.metrics, s.stretchGitHub)
+}
+
+// render executes the template name with data into w and traces the execution.
+func (s *Server) render(ctx context.Context, w io.Writer, name string, data any) error {
+	return traced(ctx, "template.execute", func(ctx context.Context) error {
+		err := s.tmpl(w, name, data)
+		s.health.reportRender(ctx, err)
+		return err
+	}, attribute.String("template", name))
 }
 
 func FormatBuildVersion(version string, commit string, buildTime string) string {
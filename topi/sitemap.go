@@ -0,0 +1,155 @@
+package topi
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/shurcooL/githubv4"
+)
+
+const SitemapNamespace = "http://www.sitemaps.org/schemas/sitemap/0.9"
+
+const (
+	// sitemapPageSize is the number of posts fetched per sitemap query.
+	sitemapPageSize = 100
+	// sitemapMaxPages caps the number of pages fetched, so the sitemap lists at most sitemapPageSize*sitemapMaxPages posts.
+	sitemapMaxPages = 10
+	// sitemapTTL is how long the listed posts are cached. It applies even if no cache is configured.
+	sitemapTTL = 15 * time.Minute
+)
+
+type Sitemap struct {
+	XMLName xml.Name     `xml:"urlset"`
+	XMLNS   string       `xml:"xmlns,attr"`
+	URLs    []SitemapURL `xml:"url"`
+}
+
+type SitemapURL struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod,omitempty"`
+}
+
+func (s *Server) sitemap(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars, err := s.SiteData(ctx)
+	if err != nil {
+		s.error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	posts, err := s.cachedSitemapPosts(ctx)
+	if err != nil {
+		s.error(w, r, fmt.Errorf("failed to fetch posts: %w", err), http.StatusInternalServerError)
+		return
+	}
+
+	base := s.baseURL()
+	var indexLastMod time.Time
+	for _, project := range vars.Projects {
+		if project.UpdatedAt.After(indexLastMod) {
+			indexLastMod = project.UpdatedAt
+		}
+	}
+	postURLs := make([]SitemapURL, 0, len(posts))
+	for _, post := range posts {
+		if post.UpdatedAt.After(indexLastMod) {
+			indexLastMod = post.UpdatedAt
+		}
+		postURLs = append(postURLs, SitemapURL{
+			Loc:     fmt.Sprintf("%s/posts/%d", base, post.Number),
+			LastMod: formatLastMod(post.UpdatedAt),
+		})
+	}
+
+	sitemap := Sitemap{
+		XMLNS: SitemapNamespace,
+		URLs: append([]SitemapURL{{
+			Loc:     base + "/",
+			LastMod: formatLastMod(indexLastMod),
+		}}, postURLs...),
+	}
+
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	setLastModified(w, indexLastMod)
+	_, _ = io.WriteString(w, xml.Header)
+	if err = xml.NewEncoder(w).Encode(sitemap); err != nil {
+		slog.ErrorContext(ctx, "failed to write sitemap", slog.Any("error", err))
+	}
+}
+
+// SitemapPost is the part of a post listed in the sitemap.
+type SitemapPost struct {
+	Number    int
+	UpdatedAt time.Time
+}
+
+// FetchSitemapPosts fetches the number and the last update of up to sitemapMaxPages pages of posts.
+func (s *Server) FetchSitemapPosts(ctx context.Context) ([]SitemapPost, error) {
+	if s.cfg.GitHub.PostsRepository == "" {
+		return nil, nil
+	}
+
+	var category *githubv4.ID
+	if s.cfg.GitHub.PostsCategory != "" {
+		category = githubv4.NewID(githubv4.ID(s.cfg.GitHub.PostsCategory))
+	}
+
+	var (
+		posts []SitemapPost
+		after string
+	)
+	for page := 0; page < sitemapMaxPages; page++ {
+		var query struct {
+			RateLimited
+			User struct {
+				Repository struct {
+					Discussions struct {
+						Nodes    []SitemapPost
+						PageInfo PageInfo
+					} `graphql:"discussions(after: $after, first: $posts, categoryId: $category, orderBy: {field: CREATED_AT, direction: DESC})"`
+				} `graphql:"repository(name: $repository)"`
+			} `graphql:"user(login: $user)"`
+		}
+		variables := map[string]interface{}{
+			"user":       githubv4.String(s.cfg.GitHub.User),
+			"repository": githubv4.String(s.cfg.GitHub.PostsRepository),
+			"posts":      githubv4.Int(sitemapPageSize),
+			"after":      cursor(after),
+			"category":   category,
+		}
+		if err := s.query(ctx, "sitemap", &query, variables); err != nil {
+			return nil, err
+		}
+
+		posts = append(posts, query.User.Repository.Discussions.Nodes...)
+		if after = nextCursor(query.User.Repository.Discussions.PageInfo); after == "" {
+			break
+		}
+	}
+	return posts, nil
+}
+
+func (s *Server) robots(w http.ResponseWriter, r *http.Request) {
+	file, err := s.assets.Open("/assets/robots.txt")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer file.Close()
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	_, _ = io.Copy(w, file)
+	_, _ = fmt.Fprintf(w, "\nSitemap: %s/sitemap.xml\n", s.baseURL())
+}
+
+func formatLastMod(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,43 @@
+package topi
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/shurcooL/githubv4"
+	"github.com/yuin/goldmark"
+)
+
+func TestSitemapPostsArePagedAndCached(t *testing.T) {
+	var queries int
+	github := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		queries++
+		// every page claims that there are more posts
+		_, _ = fmt.Fprintf(w, `{"data":{"user":{"repository":{"discussions":{"nodes":[{"number":%d,"updatedAt":"2024-01-01T00:00:00Z"}],"pageInfo":{"endCursor":"%d","hasNextPage":true}}}}}}`, queries, queries)
+	}))
+	defer github.Close()
+
+	cfg := Config{
+		PublicURL: "https://example.com",
+		GitHub:    GitHubConfig{User: "user", PostsRepository: "posts"},
+	}
+	githubClient := githubv4.NewEnterpriseClient(github.URL, &http.Client{Transport: RecordResponses(http.DefaultTransport)})
+	s := NewServer("test", cfg, http.DefaultClient, githubClient, goldmark.New(), http.Dir("."), nil, func(io.Writer, string, any) error { return nil }, nil)
+
+	for i := 0; i < 2; i++ {
+		posts, err := s.cachedSitemapPosts(context.Background())
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(posts) != sitemapMaxPages {
+			t.Fatalf("expected %d posts, got %d", sitemapMaxPages, len(posts))
+		}
+	}
+	if queries != sitemapMaxPages {
+		t.Fatalf("expected %d queries, got %d", sitemapMaxPages, queries)
+	}
+}
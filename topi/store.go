@@ -0,0 +1,163 @@
+package topi
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+var (
+	storeBucket = []byte("topi")
+
+	storeKeySnapshot = []byte("snapshot")
+	storeKeyLastFM   = []byte("lastfm")
+)
+
+// OpenDiskStore opens or creates the database in dir which persists upstream data across restarts.
+func OpenDiskStore(dir string) (*DiskStore, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("failed to create data dir: %w", err)
+	}
+
+	db, err := bbolt.Open(filepath.Join(dir, "topi.db"), 0o600, &bbolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+
+	if err = db.Update(func(tx *bbolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(storeBucket)
+		return err
+	}); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("failed to create bucket: %w", err)
+	}
+
+	return &DiskStore{db: db}, nil
+}
+
+// persistInterval is how often unchanged data is persisted again, so not every fetch costs a write and fsync.
+const persistInterval = 5 * time.Minute
+
+// DiskStore persists the last good upstream data, so a fresh instance can serve pages before GitHub answers.
+type DiskStore struct {
+	db *bbolt.DB
+
+	mu     sync.Mutex
+	lastFM *storedLastFM
+}
+
+// storedSnapshot is a persisted Snapshot. Identity is the GitHubConfig.Identity the data was fetched for,
+// so data of another user or repository isn't served after the config changed.
+type storedSnapshot struct {
+	Identity  string
+	Vars      *Variables
+	FetchedAt time.Time
+}
+
+func (d *DiskStore) SaveSnapshot(identity string, snapshot Snapshot) error {
+	return d.put(storeKeySnapshot, storedSnapshot{
+		Identity:  identity,
+		Vars:      snapshot.Vars,
+		FetchedAt: snapshot.FetchedAt,
+	})
+}
+
+// LoadSnapshot returns the persisted snapshot or nil if there is none for identity.
+func (d *DiskStore) LoadSnapshot(identity string) (*Snapshot, error) {
+	var stored storedSnapshot
+	if ok, err := d.get(storeKeySnapshot, &stored); !ok || err != nil || stored.Identity != identity {
+		return nil, err
+	}
+	return &Snapshot{
+		Vars:      stored.Vars,
+		FetchedAt: stored.FetchedAt,
+	}, nil
+}
+
+func (d *DiskStore) DeleteSnapshot() error {
+	return d.db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket(storeBucket).Delete(storeKeySnapshot)
+	})
+}
+
+// storedLastFM is a persisted LastFM. Identity is the Last.fm username the data was fetched for.
+type storedLastFM struct {
+	Identity string
+	LastFM
+}
+
+// SaveLastFM persists lastFM if it changed since the last save or the last save is older than persistInterval.
+func (d *DiskStore) SaveLastFM(identity string, lastFM LastFM) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if saved := d.lastFM; saved != nil && saved.Identity == identity && lastFM.FetchedAt.Sub(saved.FetchedAt) < persistInterval &&
+		saved.URL == lastFM.URL && reflect.DeepEqual(saved.Track, lastFM.Track) && reflect.DeepEqual(saved.Recent, lastFM.Recent) {
+		return nil
+	}
+
+	stored := storedLastFM{
+		Identity: identity,
+		LastFM:   lastFM,
+	}
+	if err := d.put(storeKeyLastFM, stored); err != nil {
+		return err
+	}
+	d.lastFM = &stored
+	return nil
+}
+
+// LoadLastFM returns the persisted Last.fm state or nil if there is none for identity.
+func (d *DiskStore) LoadLastFM(identity string) (*LastFM, error) {
+	var stored storedLastFM
+	if ok, err := d.get(storeKeyLastFM, &stored); !ok || err != nil || stored.Identity != identity {
+		return nil, err
+	}
+	return &stored.LastFM, nil
+}
+
+func (d *DiskStore) DeleteLastFM() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.lastFM = nil
+	return d.db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket(storeBucket).Delete(storeKeyLastFM)
+	})
+}
+
+func (d *DiskStore) Close() error {
+	return d.db.Close()
+}
+
+func (d *DiskStore) put(key []byte, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return d.db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket(storeBucket).Put(key, data)
+	})
+}
+
+func (d *DiskStore) get(key []byte, v any) (bool, error) {
+	var data []byte
+	if err := d.db.View(func(tx *bbolt.Tx) error {
+		// the value is only valid during the transaction, so copy it
+		data = append(data, tx.Bucket(storeBucket).Get(key)...)
+		return nil
+	}); err != nil {
+		return false, err
+	}
+	if data == nil {
+		return false, nil
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return false, fmt.Errorf("failed to decode %s: %w", key, err)
+	}
+	return true, nil
+}
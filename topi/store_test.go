@@ -0,0 +1,39 @@
+package topi
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDiskStoreIgnoresOtherIdentities(t *testing.T) {
+	disk, err := OpenDiskStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to open disk store: %v", err)
+	}
+	defer disk.Close()
+
+	if err = disk.SaveSnapshot("old/repo#", Snapshot{Vars: &Variables{}, FetchedAt: time.Now()}); err != nil {
+		t.Fatalf("failed to save snapshot: %v", err)
+	}
+	if err = disk.SaveLastFM("old", LastFM{FetchedAt: time.Now()}); err != nil {
+		t.Fatalf("failed to save lastfm: %v", err)
+	}
+
+	if snapshot, err := disk.LoadSnapshot("new/repo#"); err != nil || snapshot != nil {
+		t.Fatalf("expected no snapshot for another identity, got %+v, %v", snapshot, err)
+	}
+	if snapshot, err := disk.LoadSnapshot("old/repo#"); err != nil || snapshot == nil {
+		t.Fatalf("expected the snapshot of the same identity, got %+v, %v", snapshot, err)
+	}
+	if lastFM, err := disk.LoadLastFM("new"); err != nil || lastFM != nil {
+		t.Fatalf("expected no lastfm state for another user, got %+v, %v", lastFM, err)
+	}
+	if lastFM, err := disk.LoadLastFM("old"); err != nil || lastFM == nil {
+		t.Fatalf("expected the lastfm state of the same user, got %+v, %v", lastFM, err)
+	}
+
+	NewSnapshotStore(disk, "old/repo#").Reset("new/repo#")
+	if snapshot, err := disk.LoadSnapshot("old/repo#"); err != nil || snapshot != nil {
+		t.Fatalf("expected the snapshot to be deleted on reset, got %+v, %v", snapshot, err)
+	}
+}